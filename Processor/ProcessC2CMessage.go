@@ -2,6 +2,7 @@
 package Processor
 
 import (
+	"strconv"
 	"time"
 
 	"github.com/hoshinonyaruko/gensokyo-mcp/config"
@@ -10,76 +11,108 @@ import (
 	"github.com/mark3labs/mcp-go/mcp"
 )
 
-// ProcessC2CMessage 处理C2C消息 群私聊
-func ProcessC2CMessage(data mcp.CallToolRequest, bearer int64, Wsclient []*wsclient.WebSocketClient) (err error) {
-	// 打印data结构体
-	PrintStructWithFieldNames(data)
-
-	// 从私信中提取必要的信息 这是测试回复需要用到
-	//recipientID := data.Author.ID
-	//ChannelID := data.ChannelID
-	//sourece是源头频道
-	//GuildID := data.GuildID
-
-	// 直接转换成ob11私信
+// ProcessC2CMessage 处理C2C消息 群私聊 messageID 为本次上报事件的 message_id
+func ProcessC2CMessage(data mcp.CallToolRequest, messageID int, Wsclient []*wsclient.WebSocketClient) (err error) {
 
 	selfid := config.GetUinint64()
 
-	//收到私聊信息调用的具体还原步骤
-	//1,idmap还原真实userid,
-	//发信息使用的是userid
+	var args struct {
+		Payload  string  `json:"payload"`
+		UserID   string  `json:"user_id"`
+		Nickname string  `json:"nickname"`
+		SubType  string  `json:"sub_type"`
+		Timeout  float64 `json:"timeout"`
+	}
+	if err := data.BindArguments(&args); err != nil {
+		return err
+	}
+	if args.Payload == "" {
+		args.Payload = "帮助"
+	}
+	// friend 好友 group 群临时会话 other 其他
+	if args.SubType == "" {
+		args.SubType = "friend"
+	}
 
-	//转换at
-	// messageText := handlers.RevertTransformedText(data, "group_private", p.Api, p.Apiv2, userid64, userid64, config.GetWhiteEnable(5))
-	// if messageText == "" {
-	// 	mylog.Printf("信息被自定义黑白名单拦截")
-	// 	return nil
-	// }
 	//框架内指令
 	//p.HandleFrameworkCommand(messageText, data, "group_private")
+	// raw_message 始终为规范的CQ码字符串
+	messageText := handlers.NormalizeRawMessage(args.Payload)
 
-	messageText := data.Params.Arguments.(string)
 	//如果在Array模式下, 则处理Message为Segment格式
 	var segmentedMessages interface{} = messageText
 	if config.GetArrayValue() {
 		segmentedMessages = handlers.ConvertToSegmentedMessage(messageText)
 	}
 	var IsBindedUserId bool
-	// if config.GetHashIDValue() {
-	// 	IsBindedUserId = idmap.CheckValue(data.Author.ID, userid64)
-	// } else {
-	// 	IsBindedUserId = idmap.CheckValuev2(userid64)
-	// }
-
-	privateMsg := OnebotPrivateMessage{
-		RawMessage:  messageText,
-		Message:     segmentedMessages,
-		MessageID:   123,
-		MessageType: "private",
-		PostType:    "message",
-		SelfID:      selfid,
-		UserID:      bearer,
-		Sender: PrivateSender{
-			Nickname: "", //这个不支持,但加机器人好友,会收到一个事件,可以对应储存获取,用idmaps可以做到.
-			UserID:   bearer,
-		},
-		SubType: "friend",
-		Time:    time.Now().Unix(),
-	}
-	if !config.GetNativeOb11() {
-		privateMsg.RealMessageType = "group_private"
-		privateMsg.IsBindedUserId = IsBindedUserId
-		// if IsBindedUserId {
-		// 	//privateMsg.Avatar, _ = GenerateAvatarURL(userid64)
-		// }
-	}
 
-	// 调试
-	PrintStructWithFieldNames(privateMsg)
+	// 是否使用string形式上报
+	if !config.GetStringOb11() {
+
+		intUser, _ := strconv.ParseInt(args.UserID, 10, 64)
+
+		privateMsg := OnebotPrivateMessage{
+			RawMessage:  messageText,
+			Message:     segmentedMessages,
+			MessageID:   messageID,
+			MessageType: "private",
+			PostType:    "message",
+			SelfID:      selfid,
+			UserID:      intUser,
+			Sender: PrivateSender{
+				Nickname: args.Nickname,
+				UserID:   intUser,
+			},
+			SubType: args.SubType,
+			Time:    time.Now().Unix(),
+		}
+		//增强配置
+		if !config.GetNativeOb11() {
+			privateMsg.RealMessageType = "group_private"
+			privateMsg.IsBindedUserId = IsBindedUserId
+		}
+
+		// 调试
+		PrintStructWithFieldNames(privateMsg)
+
+		// Convert OnebotPrivateMessage to map and send
+		privateMsgMap := structToMap(privateMsg)
+		saveEvent(messageID, privateMsgMap)
+		//上报信息到onebotv11应用端(正反ws)
+		BroadcastMessageToAll(privateMsgMap, Wsclient)
+	} else {
+
+		privateMsg := OnebotPrivateMessageS{
+			RawMessage:  messageText,
+			Message:     segmentedMessages,
+			MessageID:   strconv.Itoa(messageID),
+			MessageType: "private",
+			PostType:    "message",
+			SelfID:      selfid,
+			UserID:      args.UserID,
+			Sender: PrivateSenderS{
+				Nickname: args.Nickname,
+				UserID:   args.UserID,
+			},
+			SubType:    args.SubType,
+			Time:       time.Now().Unix(),
+			RealUserID: args.UserID,
+		}
+		//增强配置
+		if !config.GetNativeOb11() {
+			privateMsg.RealMessageType = "group_private"
+			privateMsg.IsBindedUserId = IsBindedUserId
+		}
+
+		// 调试
+		PrintStructWithFieldNames(privateMsg)
+
+		// Convert OnebotPrivateMessageS to map and send
+		privateMsgMap := structToMap(privateMsg)
+		saveEvent(messageID, privateMsgMap)
+		//上报信息到onebotv11应用端(正反ws)
+		BroadcastMessageToAll(privateMsgMap, Wsclient)
+	}
 
-	// Convert OnebotGroupMessage to map and send
-	privateMsgMap := structToMap(privateMsg)
-	//上报信息到onebotv11应用端(正反ws)
-	BroadcastMessageToAll(privateMsgMap, Wsclient)
 	return err
 }
@@ -11,17 +11,17 @@ import (
 	"github.com/mark3labs/mcp-go/mcp"
 )
 
-// ProcessGroupMessage 处理群组消息
-func ProcessGroupMessage(data mcp.CallToolRequest, Wsclient []*wsclient.WebSocketClient) (err error) {
+// ProcessGroupMessage 处理群组消息 messageID 为本次上报事件的 message_id
+func ProcessGroupMessage(data mcp.CallToolRequest, messageID int, Wsclient []*wsclient.WebSocketClient) (err error) {
 
 	selfid := config.GetUinint64()
 
 	var args struct {
-		Payload string `json:"payload"`
-		UserID  string `json:"user_id"`
-		GroupID string `json:"group_id"`
-		Timeout int    `json:"timeout"`
-		Bearer  int64  `json:"bearer,omitempty"`
+		Payload string  `json:"payload"`
+		UserID  string  `json:"user_id"`
+		GroupID string  `json:"group_id"`
+		Timeout float64 `json:"timeout"`
+		Bearer  int64   `json:"bearer,omitempty"`
 	}
 	if err := data.BindArguments(&args); err != nil {
 		return err
@@ -31,7 +31,8 @@ func ProcessGroupMessage(data mcp.CallToolRequest, Wsclient []*wsclient.WebSocke
 	}
 
 	//p.HandleFrameworkCommand(messageText, data, "group")
-	messageText := args.Payload
+	// raw_message 始终为规范的CQ码字符串
+	messageText := handlers.NormalizeRawMessage(args.Payload)
 
 	// 如果在Array模式下, 则处理Message为Segment格式
 	var segmentedMessages interface{} = messageText
@@ -49,19 +50,19 @@ func ProcessGroupMessage(data mcp.CallToolRequest, Wsclient []*wsclient.WebSocke
 		groupMsg := OnebotGroupMessage{
 			RawMessage:  messageText,
 			Message:     segmentedMessages,
-			MessageID:   123,
+			MessageID:   messageID,
 			GroupID:     int64(intGroup),
 			MessageType: "group",
 			PostType:    "message",
 			SelfID:      selfid,
 			UserID:      int64(intUser),
-			Sender: Sender{
+			Sender: memberSender(Sender{
 				UserID: int64(intUser),
 				Sex:    "0",
 				Age:    0,
 				Area:   "0",
 				Level:  "0",
-			},
+			}, args.GroupID, args.UserID),
 			SubType: "normal",
 			Time:    time.Now().Unix(),
 		}
@@ -80,6 +81,7 @@ func ProcessGroupMessage(data mcp.CallToolRequest, Wsclient []*wsclient.WebSocke
 
 		// Convert OnebotGroupMessage to map and send
 		groupMsgMap := structToMap(groupMsg)
+		saveEvent(messageID, groupMsgMap)
 		//上报信息到onebotv11应用端(正反ws)
 		BroadcastMessageToAll(groupMsgMap, Wsclient)
 	} else {
@@ -87,19 +89,19 @@ func ProcessGroupMessage(data mcp.CallToolRequest, Wsclient []*wsclient.WebSocke
 		groupMsg := OnebotGroupMessageS{
 			RawMessage:  messageText,
 			Message:     segmentedMessages,
-			MessageID:   "",
+			MessageID:   strconv.Itoa(messageID),
 			GroupID:     args.GroupID,
 			MessageType: "group",
 			PostType:    "message",
 			SelfID:      selfid,
 			UserID:      args.UserID,
-			Sender: Sender{
+			Sender: memberSender(Sender{
 				UserID: 0,
 				Sex:    "0",
 				Age:    0,
 				Area:   "0",
 				Level:  "0",
-			},
+			}, args.GroupID, args.UserID),
 			SubType:     "normal",
 			Time:        time.Now().Unix(),
 			RealGroupID: args.GroupID,
@@ -121,6 +123,7 @@ func ProcessGroupMessage(data mcp.CallToolRequest, Wsclient []*wsclient.WebSocke
 
 		// Convert OnebotGroupMessage to map and send
 		groupMsgMap := structToMap(groupMsg)
+		saveEvent(messageID, groupMsgMap)
 		//上报信息到onebotv11应用端(正反ws)
 		BroadcastMessageToAll(groupMsgMap, Wsclient)
 	}
@@ -0,0 +1,99 @@
+// 处理收到的信息事件
+package Processor
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo-mcp/config"
+	"github.com/hoshinonyaruko/gensokyo-mcp/wsclient"
+)
+
+// 按钮回调事件 与gensokyo上报的 interaction 通知一致
+type OnebotInteractionNotice struct {
+	GroupID    interface{}     `json:"group_id,omitempty"`
+	NoticeType string          `json:"notice_type"`
+	PostType   string          `json:"post_type"`
+	SelfID     int64           `json:"self_id"`
+	SubType    string          `json:"sub_type"`
+	Time       int64           `json:"time"`
+	UserID     interface{}     `json:"user_id"`
+	Data       InteractionData `json:"data"`
+}
+
+type InteractionData struct {
+	ID                string                `json:"id"`
+	Type              int                   `json:"type"`      // 11 消息按钮
+	ChatType          int                   `json:"chat_type"` // 1 群聊 2 私聊
+	Timestamp         string                `json:"timestamp"`
+	GroupOpenID       string                `json:"group_openid,omitempty"`
+	GroupMemberOpenID string                `json:"group_member_openid,omitempty"`
+	UserOpenID        string                `json:"user_openid,omitempty"`
+	Data              InteractionDataDetail `json:"data"`
+	Version           int                   `json:"version"`
+}
+
+type InteractionDataDetail struct {
+	Type     int                 `json:"type"`
+	Resolved InteractionResolved `json:"resolved"`
+}
+
+type InteractionResolved struct {
+	ButtonData string `json:"button_data"`
+	ButtonID   string `json:"button_id"`
+	UserID     string `json:"user_id"`
+}
+
+// ProcessInteraction 上报按钮回调事件 groupID 为空时为私聊按钮 eventID 为本次事件的id
+func ProcessInteraction(userID, groupID, buttonID, buttonData string, eventID int, Wsclient []*wsclient.WebSocketClient) error {
+	notice := OnebotInteractionNotice{
+		NoticeType: "interaction",
+		PostType:   "notice",
+		SelfID:     config.GetUinint64(),
+		SubType:    "create",
+		Time:       time.Now().Unix(),
+		Data: InteractionData{
+			ID:        strconv.Itoa(eventID),
+			Type:      11,
+			ChatType:  2,
+			Timestamp: time.Now().Format(time.RFC3339),
+			Data: InteractionDataDetail{
+				Type: 11,
+				Resolved: InteractionResolved{
+					ButtonData: buttonData,
+					ButtonID:   buttonID,
+					UserID:     userID,
+				},
+			},
+			Version: 1,
+		},
+	}
+	if groupID != "" {
+		notice.Data.ChatType = 1
+		notice.Data.GroupOpenID = groupID
+		notice.Data.GroupMemberOpenID = userID
+	} else {
+		notice.Data.UserOpenID = userID
+	}
+
+	// 是否使用string形式上报
+	if config.GetStringOb11() {
+		notice.UserID = userID
+		if groupID != "" {
+			notice.GroupID = groupID
+		}
+	} else {
+		intUser, _ := strconv.ParseInt(userID, 10, 64)
+		notice.UserID = intUser
+		if groupID != "" {
+			intGroup, _ := strconv.ParseInt(groupID, 10, 64)
+			notice.GroupID = intGroup
+		}
+	}
+
+	// 调试
+	PrintStructWithFieldNames(notice)
+
+	//上报信息到onebotv11应用端(正反ws)
+	return BroadcastMessageToAll(structToMap(notice), Wsclient)
+}
@@ -0,0 +1,234 @@
+// 处理收到的信息事件
+package Processor
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo-mcp/botstats"
+	"github.com/hoshinonyaruko/gensokyo-mcp/config"
+	"github.com/hoshinonyaruko/gensokyo-mcp/cq"
+	"github.com/hoshinonyaruko/gensokyo-mcp/wsclient"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// 通知事件 字段按 notice_type 取用,未用到的字段不上报
+type OnebotNotice struct {
+	Time       int64       `json:"time"`
+	SelfID     int64       `json:"self_id"`
+	PostType   string      `json:"post_type"`
+	NoticeType string      `json:"notice_type"`
+	SubType    string      `json:"sub_type,omitempty"`
+	GroupID    interface{} `json:"group_id,omitempty"`
+	UserID     interface{} `json:"user_id"`
+	OperatorID interface{} `json:"operator_id,omitempty"`
+	TargetID   interface{} `json:"target_id,omitempty"`
+	MessageID  interface{} `json:"message_id,omitempty"`
+	Duration   *int64      `json:"duration,omitempty"`
+}
+
+// 请求事件
+type OnebotRequest struct {
+	Time        int64       `json:"time"`
+	SelfID      int64       `json:"self_id"`
+	PostType    string      `json:"post_type"`
+	RequestType string      `json:"request_type"`
+	SubType     string      `json:"sub_type,omitempty"`
+	GroupID     interface{} `json:"group_id,omitempty"`
+	UserID      interface{} `json:"user_id"`
+	Comment     string      `json:"comment"`
+	Flag        string      `json:"flag"`
+}
+
+// NoticeArgs send_notice 工具的参数
+type NoticeArgs struct {
+	NoticeType string `json:"notice_type"`
+	SubType    string `json:"sub_type"`
+	UserID     string `json:"user_id"`
+	GroupID    string `json:"group_id"`
+	OperatorID string `json:"operator_id"`
+	TargetID   string `json:"target_id"`
+	MessageID  string `json:"message_id"`
+	Duration   *int64 `json:"duration"`
+}
+
+// RequestArgs send_request 工具的参数
+type RequestArgs struct {
+	RequestType string `json:"request_type"`
+	SubType     string `json:"sub_type"`
+	UserID      string `json:"user_id"`
+	GroupID     string `json:"group_id"`
+	Comment     string `json:"comment"`
+}
+
+// defaultNoticeSubTypes 各通知类型默认的 sub_type
+var defaultNoticeSubTypes = map[string]string{
+	"group_increase": "approve",
+	"group_decrease": "leave",
+	"group_ban":      "ban",
+	"poke":           "poke",
+}
+
+// IsGroupNotice 通知是否发生在群内,poke 在未指定群时为好友戳一戳
+func (a NoticeArgs) IsGroupNotice() bool {
+	switch a.NoticeType {
+	case "friend_add", "friend_recall":
+		return false
+	case "poke":
+		return a.GroupID != "" && a.GroupID != "0"
+	}
+	return true
+}
+
+// RequestFlag 请求事件的 flag,应用端处理请求时原样带回
+func RequestFlag(eventID int) string {
+	return "mcp_request_" + strconv.Itoa(eventID)
+}
+
+// ResolveRecall 撤回通知未指定 message_id 时,取该群(该用户)最近一条已保存的消息,
+// 应用端可用 get_msg 读取被撤回的内容;群撤回未指定用户时以该消息的发送者为 user_id
+func (a *NoticeArgs) ResolveRecall() error {
+	if a.NoticeType != "group_recall" && a.NoticeType != "friend_recall" {
+		return nil
+	}
+	if a.MessageID != "" {
+		return nil
+	}
+
+	userID := ""
+	if a.UserID != "" && a.UserID != "0" {
+		userID = cq.Stringify(onebotID(a.UserID))
+	}
+	var record *botstats.MessageRecord
+	var err error
+	if a.NoticeType == "group_recall" {
+		record, err = botstats.LatestMessage("group", cq.Stringify(onebotID(a.GroupID)), userID)
+	} else {
+		if userID == "" {
+			return fmt.Errorf("friend_recall 需要 user_id 或 message_id")
+		}
+		record, err = botstats.LatestMessage("private", "", userID)
+	}
+	if err != nil {
+		return fmt.Errorf("没有可撤回的消息,请指定 message_id: %w", err)
+	}
+
+	a.MessageID = strconv.Itoa(record.MessageID)
+	if userID == "" {
+		a.UserID = record.UserID
+	}
+	return nil
+}
+
+// ProcessNotice 上报通知事件,撤回通知的 message_id 需先经 ResolveRecall 补全
+func ProcessNotice(args NoticeArgs, Wsclient []*wsclient.WebSocketClient) error {
+	if args.SubType == "" {
+		args.SubType = defaultNoticeSubTypes[args.NoticeType]
+	}
+
+	selfid := config.GetUinint64()
+	notice := OnebotNotice{
+		Time:       time.Now().Unix(),
+		SelfID:     selfid,
+		PostType:   "notice",
+		NoticeType: args.NoticeType,
+		UserID:     onebotID(args.UserID),
+	}
+	if args.IsGroupNotice() {
+		notice.GroupID = onebotID(args.GroupID)
+	}
+
+	switch args.NoticeType {
+	case "group_increase", "group_decrease":
+		notice.SubType = args.SubType
+		notice.OperatorID = operatorID(args)
+	case "group_ban":
+		notice.SubType = args.SubType
+		notice.OperatorID = operatorID(args)
+		// 解除禁言时 duration 为 0
+		duration := int64(600)
+		if args.SubType == "lift_ban" {
+			duration = 0
+		} else if args.Duration != nil {
+			duration = *args.Duration
+		}
+		notice.Duration = &duration
+	case "group_recall", "friend_recall":
+		if args.NoticeType == "group_recall" {
+			notice.OperatorID = operatorID(args)
+		}
+		notice.MessageID = onebotID(args.MessageID)
+	case "poke":
+		// 戳一戳为 notify 通知的子类型
+		notice.NoticeType = "notify"
+		notice.SubType = "poke"
+		targetID := args.TargetID
+		if targetID == "" || targetID == "0" {
+			targetID = strconv.FormatInt(selfid, 10)
+		}
+		notice.TargetID = onebotID(targetID)
+	case "friend_add":
+	default:
+		return fmt.Errorf("unsupported notice_type: %s", args.NoticeType)
+	}
+
+	// 调试
+	PrintStructWithFieldNames(notice)
+
+	//上报信息到onebotv11应用端(正反ws)
+	return BroadcastMessageToAll(structToMap(notice), Wsclient)
+}
+
+// ProcessRequest 上报加好友/加群请求事件 flag 由 RequestFlag(eventID) 生成
+func ProcessRequest(data mcp.CallToolRequest, eventID int, Wsclient []*wsclient.WebSocketClient) error {
+	var args RequestArgs
+	if err := data.BindArguments(&args); err != nil {
+		return err
+	}
+
+	request := OnebotRequest{
+		Time:        time.Now().Unix(),
+		SelfID:      config.GetUinint64(),
+		PostType:    "request",
+		RequestType: args.RequestType,
+		UserID:      onebotID(args.UserID),
+		Comment:     args.Comment,
+		Flag:        RequestFlag(eventID),
+	}
+	switch args.RequestType {
+	case "friend":
+	case "group":
+		// add 加群申请 invite 邀请机器人入群
+		request.SubType = args.SubType
+		if request.SubType == "" {
+			request.SubType = "add"
+		}
+		request.GroupID = onebotID(args.GroupID)
+	default:
+		return fmt.Errorf("unsupported request_type: %s", args.RequestType)
+	}
+
+	// 调试
+	PrintStructWithFieldNames(request)
+
+	//上报信息到onebotv11应用端(正反ws)
+	return BroadcastMessageToAll(structToMap(request), Wsclient)
+}
+
+// operatorID 未指定操作者时视为用户自己操作
+func operatorID(args NoticeArgs) interface{} {
+	if args.OperatorID == "" || args.OperatorID == "0" {
+		return onebotID(args.UserID)
+	}
+	return onebotID(args.OperatorID)
+}
+
+// onebotID string_ob11 模式下以string上报id,否则以int上报
+func onebotID(id string) interface{} {
+	if config.GetStringOb11() {
+		return id
+	}
+	intID, _ := strconv.ParseInt(id, 10, 64)
+	return intID
+}
@@ -7,12 +7,18 @@ import (
 	"reflect"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/hashicorp/go-multierror"
+	"github.com/hoshinonyaruko/gensokyo-mcp/botstats"
 	"github.com/hoshinonyaruko/gensokyo-mcp/callapi"
+	"github.com/hoshinonyaruko/gensokyo-mcp/cq"
+	"github.com/hoshinonyaruko/gensokyo-mcp/members"
 	"github.com/hoshinonyaruko/gensokyo-mcp/mylog"
 	"github.com/hoshinonyaruko/gensokyo-mcp/structs"
 	"github.com/hoshinonyaruko/gensokyo-mcp/wsclient"
+	"github.com/hoshinonyaruko/gensokyo-mcp/wsserver"
 )
 
 // Processor 结构体用于处理消息
@@ -128,6 +134,65 @@ type PrivateSender struct {
 	UserID   int64  `json:"user_id"` // Can be either string or int depending on logic
 }
 
+// 私聊信息事件 string_ob11
+type OnebotPrivateMessageS struct {
+	RawMessage      string         `json:"raw_message"`
+	MessageID       string         `json:"message_id"`
+	MessageType     string         `json:"message_type"`
+	PostType        string         `json:"post_type"`
+	SelfID          int64          `json:"self_id"`
+	Sender          PrivateSenderS `json:"sender"`
+	SubType         string         `json:"sub_type"`
+	Time            int64          `json:"time"`
+	Avatar          string         `json:"avatar,omitempty"`
+	Echo            string         `json:"echo,omitempty"`
+	Message         interface{}    `json:"message"` // For array format
+	MessageSeq      int            `json:"message_seq"`
+	Font            int            `json:"font"`
+	UserID          string         `json:"user_id"`
+	RealMessageType string         `json:"real_message_type,omitempty"` //当前信息的真实类型 group group_private guild guild_private
+	RealUserID      string         `json:"real_user_id,omitempty"`      //当前真实uid
+	IsBindedUserId  bool           `json:"is_binded_user_id,omitempty"` //当前用户号号是否是binded后的
+}
+
+type PrivateSenderS struct {
+	Nickname string `json:"nickname"`
+	UserID   string `json:"user_id"`
+}
+
+// messageIDSeq 上报事件使用的 message_id 序列,以启动时间为种子避免重启后重复
+var messageIDSeq = int32(time.Now().Unix() % 1000000 * 1000)
+
+// NextMessageID 分配一个新的上报事件 message_id,数据库不可用时使用内存中的序列
+func NextMessageID() int {
+	id, err := botstats.NextMessageID()
+	if err != nil {
+		mylog.Printf("Error allocating message_id: %v", err)
+		return int(atomic.AddInt32(&messageIDSeq, 1))
+	}
+	return id
+}
+
+// saveEvent 上报前保存消息事件,供 get_msg 与 delete_msg 查询,并将发送者登记到成员目录
+func saveEvent(messageID int, event map[string]interface{}) {
+	if err := botstats.SaveEvent(messageID, event); err != nil {
+		mylog.Printf("Error saving message %d: %v", messageID, err)
+	}
+	sender, _ := event["sender"].(map[string]interface{})
+	members.Observe(cq.Stringify(event["group_id"]), cq.Stringify(event["user_id"]), sender)
+}
+
+// memberSender 以成员目录中的资料填充群消息的发送者
+func memberSender(sender Sender, groupID, userID string) Sender {
+	if member, ok := members.Member(groupID, userID); ok {
+		sender.Nickname = member.Nickname
+		sender.Card = member.Card
+		sender.Role = member.Role
+		sender.Title = member.Title
+	}
+	return sender
+}
+
 // 打印结构体的函数
 func PrintStructWithFieldNames(v interface{}) {
 	val := reflect.ValueOf(v)
@@ -252,7 +317,7 @@ func (p *Processors) BroadcastMessageToAll(message map[string]interface{}, data
 	}
 
 	if len(errors) > 0 {
-		return fmt.Errorf(strings.Join(errors, "; "))
+		return fmt.Errorf("%s", strings.Join(errors, "; "))
 	}
 
 	return nil
@@ -271,9 +336,16 @@ func BroadcastMessageToAll(message map[string]interface{}, Wsclient []*wsclient.
 		}
 	}
 
+	// 发送到连接到我们正向ws服务器的应用端
+	for _, client := range wsserver.EventClients() {
+		if err := client.SendMessage(message); err != nil {
+			errors = append(errors, fmt.Sprintf("error sending message via wsserver: %v", err))
+		}
+	}
+
 	// 在循环结束后处理记录的错误
 	if len(errors) > 0 {
-		return fmt.Errorf(strings.Join(errors, "; "))
+		return fmt.Errorf("%s", strings.Join(errors, "; "))
 	}
 
 	return nil
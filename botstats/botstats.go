@@ -30,7 +30,8 @@ func InitializeDB() {
 		if err != nil {
 			return err
 		}
-		return nil
+		_, err = tx.CreateBucketIfNotExists([]byte(messagesBucketName))
+		return err
 	})
 }
 
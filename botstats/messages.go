@@ -0,0 +1,338 @@
+package botstats
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo-mcp/cq"
+	"go.etcd.io/bbolt"
+)
+
+const (
+	messagesBucketName = "messages"
+	// latestBucketName 会话最近一条用户消息的索引 会话键 -> message_id
+	latestBucketName = "messages_latest"
+	// messagesMetaBucketName 消息库的元数据,记录消息数量
+	messagesMetaBucketName = "messages_meta"
+)
+
+// messageCountKey 消息数量在元数据中的键
+var messageCountKey = []byte("count")
+
+// messageRetention 消息库保留的消息数量,0为不限制
+var messageRetention atomic.Int64
+
+// SetMessageRetention 设置消息库保留的消息数量,超出时保存消息时删除最早的消息,0为不限制
+func SetMessageRetention(retention int) {
+	if retention < 0 {
+		retention = 0
+	}
+	messageRetention.Store(int64(retention))
+}
+
+// ErrMessageNotFound 消息不存在或已撤回
+var ErrMessageNotFound = errors.New("message not found")
+
+// MessageRecord 一条消息,上报的消息事件或bot发出的消息
+type MessageRecord struct {
+	MessageID   int                    `json:"message_id"`
+	Time        int64                  `json:"time"`
+	FromBot     bool                   `json:"from_bot"`     // bot发出的消息
+	MessageType string                 `json:"message_type"` // group private
+	UserID      string                 `json:"user_id"`
+	GroupID     string                 `json:"group_id,omitempty"`
+	Sender      map[string]interface{} `json:"sender,omitempty"`
+	Message     interface{}            `json:"message"`
+	Raw         json.RawMessage        `json:"raw"` // 完整的事件或action
+	Deleted     bool                   `json:"deleted,omitempty"`
+}
+
+// idBatchSize 每次从消息表的序列预留的 message_id 数量
+const idBatchSize = 100
+
+var (
+	idMu sync.Mutex
+	// nextID 与 maxID 内存中已预留但尚未分配的 message_id 区间
+	nextID, maxID uint64
+)
+
+// NextMessageID 分配一个新的 message_id,按批从消息表的序列预留,
+// 重启后从下一批继续递增,未用完的id被跳过
+func NextMessageID() (int, error) {
+	if db == nil {
+		return 0, errors.New("database is not initialized")
+	}
+	idMu.Lock()
+	defer idMu.Unlock()
+	if nextID == 0 || nextID > maxID {
+		err := db.Update(func(tx *bbolt.Tx) error {
+			b, err := tx.CreateBucketIfNotExists([]byte(messagesBucketName))
+			if err != nil {
+				return err
+			}
+			start := b.Sequence() + 1
+			if err := b.SetSequence(start + idBatchSize - 1); err != nil {
+				return err
+			}
+			nextID, maxID = start, start+idBatchSize-1
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	id := nextID
+	nextID++
+	return int(id), nil
+}
+
+// SaveEvent 保存上报的消息事件
+func SaveEvent(messageID int, event map[string]interface{}) error {
+	raw, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	record := MessageRecord{
+		MessageID:   messageID,
+		Time:        time.Now().Unix(),
+		MessageType: cq.Stringify(event["message_type"]),
+		UserID:      cq.Stringify(event["user_id"]),
+		GroupID:     cq.Stringify(event["group_id"]),
+		Message:     event["message"],
+		Raw:         raw,
+	}
+	if sender, ok := event["sender"].(map[string]interface{}); ok {
+		record.Sender = sender
+	}
+	return saveMessage(record)
+}
+
+// SaveBotMessage 保存bot发出的消息 sender 为bot自身的资料,action 为完整的action原文
+func SaveBotMessage(messageID int, messageType, userID, groupID string, sender map[string]interface{}, message interface{}, action []byte) error {
+	return saveMessage(MessageRecord{
+		MessageID:   messageID,
+		Time:        time.Now().Unix(),
+		FromBot:     true,
+		MessageType: messageType,
+		UserID:      userID,
+		GroupID:     groupID,
+		Sender:      sender,
+		Message:     message,
+		Raw:         action,
+	})
+}
+
+// GetMessage 按 message_id 读取消息,已撤回的消息返回 ErrMessageNotFound
+func GetMessage(messageID int) (*MessageRecord, error) {
+	if db == nil {
+		return nil, errors.New("database is not initialized")
+	}
+	var record MessageRecord
+	err := db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(messagesBucketName))
+		if b == nil {
+			return ErrMessageNotFound
+		}
+		data := b.Get(messageKey(messageID))
+		if data == nil {
+			return ErrMessageNotFound
+		}
+		return json.Unmarshal(data, &record)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if record.Deleted {
+		return nil, ErrMessageNotFound
+	}
+	return &record, nil
+}
+
+// LatestMessage 返回会话中最近一条未撤回的用户消息(不含bot发出的消息),
+// 群消息 groupID 非空,userID 为空时不限发送者
+func LatestMessage(messageType, groupID, userID string) (*MessageRecord, error) {
+	if db == nil {
+		return nil, errors.New("database is not initialized")
+	}
+	var found *MessageRecord
+	err := db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(messagesBucketName))
+		if b == nil {
+			return ErrMessageNotFound
+		}
+		// 先查会话索引,索引中的消息已撤回时再向前查找
+		if latest := tx.Bucket([]byte(latestBucketName)); latest != nil {
+			if id := latest.Get(latestKey(messageType, groupID, userID)); id != nil {
+				if record, ok := decodeRecord(b.Get(id)); ok && !record.Deleted {
+					found = record
+					return nil
+				}
+			}
+		}
+		c := b.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			record, ok := decodeRecord(v)
+			if !ok || record.Deleted || record.FromBot || record.MessageType != messageType {
+				continue
+			}
+			if record.GroupID != groupID || (userID != "" && record.UserID != userID) {
+				continue
+			}
+			found = record
+			return nil
+		}
+		return ErrMessageNotFound
+	})
+	return found, err
+}
+
+// decodeRecord 解码一条消息,数据为空或无法解码时返回false
+func decodeRecord(data []byte) (*MessageRecord, bool) {
+	if data == nil {
+		return nil, false
+	}
+	var record MessageRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, false
+	}
+	return &record, true
+}
+
+// DeleteMessage 撤回消息,记录保留并标记为已撤回
+func DeleteMessage(messageID int) error {
+	record, err := GetMessage(messageID)
+	if err != nil {
+		return err
+	}
+	record.Deleted = true
+	return saveMessage(*record)
+}
+
+// ParseMessageID 解析应用端传入的 message_id,兼容int与string_ob11的字符串形式
+func ParseMessageID(value interface{}) (int, error) {
+	switch v := value.(type) {
+	case int:
+		return v, nil
+	case int64:
+		return int(v), nil
+	case float64:
+		return int(v), nil
+	case string:
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, fmt.Errorf("invalid message_id: %q", v)
+		}
+		return id, nil
+	}
+	return 0, fmt.Errorf("invalid message_id: %v", value)
+}
+
+// saveMessage 保存消息,用户消息登记到会话索引,新消息超出保留数量时删除最早的消息
+func saveMessage(record MessageRecord) error {
+	if db == nil {
+		return errors.New("database is not initialized")
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(messagesBucketName))
+		if err != nil {
+			return err
+		}
+		latest, err := tx.CreateBucketIfNotExists([]byte(latestBucketName))
+		if err != nil {
+			return err
+		}
+		meta, err := tx.CreateBucketIfNotExists([]byte(messagesMetaBucketName))
+		if err != nil {
+			return err
+		}
+
+		key := messageKey(record.MessageID)
+		count := messageCount(meta, b)
+		if b.Get(key) == nil {
+			count++
+		}
+		if err := b.Put(key, data); err != nil {
+			return err
+		}
+		if !record.FromBot && !record.Deleted {
+			for _, k := range recordLatestKeys(record) {
+				if err := latest.Put(k, key); err != nil {
+					return err
+				}
+			}
+		}
+
+		count, err = pruneMessages(b, latest, count)
+		if err != nil {
+			return err
+		}
+		value := make([]byte, 8)
+		binary.BigEndian.PutUint64(value, uint64(count))
+		return meta.Put(messageCountKey, value)
+	})
+}
+
+// messageCount 读取消息数量,旧的数据库没有记录时统计一次
+func messageCount(meta, b *bbolt.Bucket) int {
+	if value := meta.Get(messageCountKey); len(value) == 8 {
+		return int(binary.BigEndian.Uint64(value))
+	}
+	return b.Stats().KeyN
+}
+
+// pruneMessages 消息数量超出保留数量时从最早的消息开始删除,
+// 同时删除指向被删除消息的会话索引,返回删除后的消息数量
+func pruneMessages(b, latest *bbolt.Bucket, count int) (int, error) {
+	retention := int(messageRetention.Load())
+	if retention <= 0 {
+		return count, nil
+	}
+	c := b.Cursor()
+	for k, v := c.First(); k != nil && count > retention; k, v = c.First() {
+		if record, ok := decodeRecord(v); ok {
+			for _, lk := range recordLatestKeys(*record) {
+				if id := latest.Get(lk); id != nil && string(id) == string(k) {
+					if err := latest.Delete(lk); err != nil {
+						return count, err
+					}
+				}
+			}
+		}
+		if err := c.Delete(); err != nil {
+			return count, err
+		}
+		count--
+	}
+	return count, nil
+}
+
+// latestKey 会话索引的键
+func latestKey(messageType, groupID, userID string) []byte {
+	return []byte(messageType + ":" + groupID + ":" + userID)
+}
+
+// recordLatestKeys 消息所属会话在索引中的键,群消息同时登记不限发送者的键
+func recordLatestKeys(record MessageRecord) [][]byte {
+	keys := [][]byte{latestKey(record.MessageType, record.GroupID, record.UserID)}
+	if record.GroupID != "" {
+		keys = append(keys, latestKey(record.MessageType, record.GroupID, ""))
+	}
+	return keys
+}
+
+// messageKey 以大端序编码,使消息按id顺序存放
+func messageKey(messageID int) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(messageID))
+	return key
+}
@@ -0,0 +1,105 @@
+package botstats
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"go.etcd.io/bbolt"
+)
+
+// openTestDB 在临时目录中打开消息库,测试结束后恢复
+func openTestDB(t *testing.T, retention int) {
+	t.Helper()
+	testDB, err := bbolt.Open(filepath.Join(t.TempDir(), "botstats.db"), 0600, &bbolt.Options{NoSync: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db = testDB
+	nextID, maxID = 0, 0
+	SetMessageRetention(retention)
+	t.Cleanup(func() {
+		testDB.Close()
+		db = nil
+		nextID, maxID = 0, 0
+		SetMessageRetention(0)
+	})
+}
+
+// saveGroupEvent 保存一条群消息事件,返回分配的 message_id
+func saveGroupEvent(t *testing.T, groupID, userID int) int {
+	t.Helper()
+	messageID, err := NextMessageID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := map[string]interface{}{
+		"message_type": "group",
+		"group_id":     groupID,
+		"user_id":      userID,
+		"message":      "hi",
+	}
+	if err := SaveEvent(messageID, event); err != nil {
+		t.Fatal(err)
+	}
+	return messageID
+}
+
+// TestMessageRetentionAcrossRestarts 重启后跳过的id不影响保留的消息数量
+func TestMessageRetentionAcrossRestarts(t *testing.T) {
+	openTestDB(t, 50)
+
+	var ids []int
+	for restart := 0; restart < 5; restart++ {
+		for i := 0; i < 20; i++ {
+			ids = append(ids, saveGroupEvent(t, 1, 2))
+		}
+		// 模拟重启,丢弃本批剩余的id
+		nextID, maxID = 0, 0
+	}
+	if ids[len(ids)-1]-ids[0] < 400 {
+		t.Fatalf("ids did not skip across restarts: %d..%d", ids[0], ids[len(ids)-1])
+	}
+
+	for i, id := range ids {
+		_, err := GetMessage(id)
+		kept := i >= len(ids)-50
+		if kept && err != nil {
+			t.Errorf("message %d: %v, want kept", id, err)
+		}
+		if !kept && !errors.Is(err, ErrMessageNotFound) {
+			t.Errorf("message %d: err = %v, want pruned", id, err)
+		}
+	}
+}
+
+// TestLatestMessage 按会话返回最近一条用户消息,撤回后返回前一条,被淘汰后找不到
+func TestLatestMessage(t *testing.T) {
+	openTestDB(t, 3)
+
+	first := saveGroupEvent(t, 1, 2)
+	second := saveGroupEvent(t, 1, 3)
+	if err := SaveBotMessage(100000, "group", "", "1", nil, "bot", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if record, err := LatestMessage("group", "1", ""); err != nil || record.MessageID != second {
+		t.Fatalf("latest in group = %v, %v, want %d", record, err, second)
+	}
+	if record, err := LatestMessage("group", "1", "2"); err != nil || record.MessageID != first {
+		t.Fatalf("latest from user 2 = %v, %v, want %d", record, err, first)
+	}
+
+	if err := DeleteMessage(second); err != nil {
+		t.Fatal(err)
+	}
+	if record, err := LatestMessage("group", "1", ""); err != nil || record.MessageID != first {
+		t.Fatalf("latest after recall = %v, %v, want %d", record, err, first)
+	}
+
+	// 其他群的消息淘汰最早的消息后,用户2的消息不再存在
+	saveGroupEvent(t, 9, 9)
+	if _, err := LatestMessage("group", "1", "2"); !errors.Is(err, ErrMessageNotFound) {
+		t.Fatalf("latest from pruned user err = %v, want ErrMessageNotFound", err)
+	}
+}
@@ -3,6 +3,8 @@ package callapi
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
+	"sync"
 
 	"github.com/hoshinonyaruko/gensokyo-mcp/mylog"
 )
@@ -70,13 +72,18 @@ type ParamsContent struct {
 	BotQQ     string      `json:"botqq,omitempty"`
 	ChannelID interface{} `json:"channel_id,omitempty"`
 	GuildID   interface{} `json:"guild_id,omitempty"`
-	GroupID   interface{} `json:"group_id,omitempty"`   // 每一种onebotv11实现的字段类型都可能不同
-	MessageID interface{} `json:"message_id,omitempty"` // 用于撤回信息
-	Message   interface{} `json:"message,omitempty"`    // 这里使用interface{}因为它可能是多种类型
-	Messages  interface{} `json:"messages,omitempty"`   // 坑爹转发信息
-	UserID    interface{} `json:"user_id,omitempty"`    // 这里使用interface{}因为它可能是多种类型
-	Duration  int         `json:"duration,omitempty"`   // 可选的整数
-	Enable    bool        `json:"enable,omitempty"`     // 可选的布尔值
+	GroupID   interface{} `json:"group_id,omitempty"`     // 每一种onebotv11实现的字段类型都可能不同
+	MessageID interface{} `json:"message_id,omitempty"`   // 用于撤回信息
+	Message   interface{} `json:"message,omitempty"`      // 这里使用interface{}因为它可能是多种类型
+	Messages  interface{} `json:"messages,omitempty"`     // 坑爹转发信息
+	UserID    interface{} `json:"user_id,omitempty"`      // 这里使用interface{}因为它可能是多种类型
+	MsgType   string      `json:"message_type,omitempty"` // send_msg 用于区分 private/group
+	Duration  int         `json:"duration,omitempty"`     // 可选的整数
+	Enable    bool        `json:"enable,omitempty"`       // 可选的布尔值
+	Flag      string      `json:"flag,omitempty"`         // 处理加好友/加群请求
+	Approve   *bool       `json:"approve,omitempty"`      // 是否同意请求,缺省为同意
+	Remark    string      `json:"remark,omitempty"`       // 同意好友请求后的备注
+	Reason    string      `json:"reason,omitempty"`       // 拒绝加群的理由
 	// handle quick operation
 	Context   Context   `json:"context,omitempty"`   // context 字段
 	Operation Operation `json:"operation,omitempty"` // operation 字段
@@ -195,23 +202,64 @@ type WebSocketServerClienter interface {
 	Close() error
 }
 
-// 根据action订阅handler处理api
+// 根据action订阅handler处理api,返回发送给应用端的响应json
 type HandlerFunc func(client Client, messgae ActionMessage) (string, error)
 
-var handlers = make(map[string]HandlerFunc)
+// Middleware 包装handler,用于日志、统计、id转换等对所有action生效的处理
+type Middleware func(action string, next HandlerFunc) HandlerFunc
+
+var (
+	handlersMu  sync.RWMutex
+	handlers    = make(map[string]HandlerFunc)
+	middlewares []Middleware
+)
 
 // RegisterHandler registers a new handler for a specific action.
 func RegisterHandler(action string, handler HandlerFunc) {
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
 	handlers[action] = handler
 }
 
+// Use 注册中间件,先注册的中间件在外层
+func Use(middleware ...Middleware) {
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+	middlewares = append(middlewares, middleware...)
+}
+
+// Actions 返回已注册的action
+func Actions() []string {
+	handlersMu.RLock()
+	defer handlersMu.RUnlock()
+	actions := make([]string, 0, len(handlers))
+	for action := range handlers {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+	return actions
+}
+
+// IsRegistered action是否已注册handler
+func IsRegistered(action string) bool {
+	handlersMu.RLock()
+	defer handlersMu.RUnlock()
+	_, ok := handlers[action]
+	return ok
+}
+
 // CallAPIFromDict 处理信息 by calling the 对应的 handler.
+// 未注册的action以 retcode 1404 响应
 func CallAPIFromDict(client Client, message ActionMessage) string {
+	handlersMu.RLock()
 	handler, ok := handlers[message.Action]
 	if !ok {
-		mylog.Println("Unsupported action:", message.Action)
-		return ""
+		handler = unsupportedHandler
+	}
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](message.Action, handler)
 	}
+	handlersMu.RUnlock()
 
 	jsonString, err := handler(client, message)
 	if err != nil {
@@ -222,3 +270,43 @@ func CallAPIFromDict(client Client, message ActionMessage) string {
 
 	return jsonString
 }
+
+// unsupportedHandler 未注册action的handler
+func unsupportedHandler(client Client, message ActionMessage) (string, error) {
+	mylog.Printf("Action '%s' is not supported.", message.Action)
+	return SendResponse(client, FailedResponse(1404, "不支持的API: "+message.Action, message.Echo))
+}
+
+// OkResponse 调用成功的响应
+func OkResponse(data interface{}, echo interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"data":    data,
+		"message": "",
+		"retcode": 0,
+		"status":  "ok",
+		"echo":    echo,
+	}
+}
+
+// FailedResponse 调用失败的响应
+func FailedResponse(retcode int, message string, echo interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"data":    nil,
+		"message": message,
+		"retcode": retcode,
+		"status":  "failed",
+		"echo":    echo,
+	}
+}
+
+// SendResponse 向发起调用的连接发送响应,返回响应json
+func SendResponse(client Client, response map[string]interface{}) (string, error) {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return "", err
+	}
+	if err := client.SendMessage(response); err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
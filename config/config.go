@@ -653,6 +653,18 @@ func GetUinint64() int64 {
 	return 0
 }
 
+// 获取SortSegments的值
+func GetSortSegments() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		mylog.Println("Warning: instance is nil when trying to SortSegments value.")
+		return false
+	}
+	return instance.Settings.SortSegments
+}
+
 // 获取Array的值
 func GetArrayValue() bool {
 	mu.Lock()
@@ -700,3 +712,342 @@ func GetTimeOut() int {
 	}
 	return instance.Settings.TimeOut
 }
+
+// GetMaxTimeOut 工具参数timeout允许的最大值 单位秒
+func GetMaxTimeOut() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil || instance.Settings.MaxTimeOut <= 0 {
+		return 60
+	}
+	return instance.Settings.MaxTimeOut
+}
+
+// 获取CollectReplies的值
+func GetCollectReplies() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		mylog.Println("Warning: instance is nil when trying to CollectReplies value.")
+		return false
+	}
+	return instance.Settings.CollectReplies
+}
+
+// 获取CollectWindow的值 单位毫秒
+func GetCollectWindow() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil || instance.Settings.CollectWindow <= 0 {
+		return 1500
+	}
+	return instance.Settings.CollectWindow
+}
+
+// 获取CollectMaxWait的值 单位秒
+func GetCollectMaxWait() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil || instance.Settings.CollectMaxWait <= 0 {
+		return 20
+	}
+	return instance.Settings.CollectMaxWait
+}
+
+// 获取CollectMaxMessages的值
+func GetCollectMaxMessages() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil || instance.Settings.CollectMaxMessages <= 0 {
+		return 10
+	}
+	return instance.Settings.CollectMaxMessages
+}
+
+// 获取ImageMaxCount的值
+func GetImageMaxCount() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil || instance.Settings.ImageMaxCount <= 0 {
+		return 9
+	}
+	return instance.Settings.ImageMaxCount
+}
+
+// 获取ImageMaxTotalKB的值
+func GetImageMaxTotalKB() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil || instance.Settings.ImageMaxTotalKB <= 0 {
+		return 10240
+	}
+	return instance.Settings.ImageMaxTotalKB
+}
+
+// 获取AudioAsText的值 语音回复是否以文本描述返回
+func GetAudioAsText() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		mylog.Println("Warning: instance is nil when trying to AudioAsText value.")
+		return false
+	}
+	return instance.Settings.AudioAsText
+}
+
+// 获取MediaFetchTimeout的值 单位秒
+func GetMediaFetchTimeout() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil || instance.Settings.MediaFetchTimeout <= 0 {
+		return 10
+	}
+	return instance.Settings.MediaFetchTimeout
+}
+
+// 获取MediaMaxKB的值
+func GetMediaMaxKB() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil || instance.Settings.MediaMaxKB <= 0 {
+		return 20480
+	}
+	return instance.Settings.MediaMaxKB
+}
+
+// 获取MediaMaxRedirects的值
+func GetMediaMaxRedirects() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil || instance.Settings.MediaMaxRedirects <= 0 {
+		return 5
+	}
+	return instance.Settings.MediaMaxRedirects
+}
+
+// 获取MediaBlockPrivate的值
+func GetMediaBlockPrivate() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		mylog.Println("Warning: instance is nil when trying to MediaBlockPrivate value.")
+		return false
+	}
+	return instance.Settings.MediaBlockPrivate
+}
+
+// 获取ImageCompressThresholdKB的值 0为不压缩
+func GetImageCompressThresholdKB() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil || instance.Settings.ImageCompressThresholdKB < 0 {
+		return 0
+	}
+	return instance.Settings.ImageCompressThresholdKB
+}
+
+// 获取ImageMaxDimension的值 0为不缩放
+func GetImageMaxDimension() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil || instance.Settings.ImageMaxDimension < 0 {
+		return 0
+	}
+	return instance.Settings.ImageMaxDimension
+}
+
+// 获取ImageMinQuality的值
+func GetImageMinQuality() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil || instance.Settings.ImageMinQuality <= 0 || instance.Settings.ImageMinQuality > 100 {
+		return 25
+	}
+	return instance.Settings.ImageMinQuality
+}
+
+// 获取ImageMaxQuality的值
+func GetImageMaxQuality() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil || instance.Settings.ImageMaxQuality <= 0 || instance.Settings.ImageMaxQuality > 100 {
+		return 75
+	}
+	return instance.Settings.ImageMaxQuality
+}
+
+// 获取MediaCache的值
+func GetMediaCache() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		mylog.Println("Warning: instance is nil when trying to MediaCache value.")
+		return false
+	}
+	return instance.Settings.MediaCache
+}
+
+// 获取MediaCacheDir的值
+func GetMediaCacheDir() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil || instance.Settings.MediaCacheDir == "" {
+		return "media_cache"
+	}
+	return instance.Settings.MediaCacheDir
+}
+
+// 获取MediaCacheQuotaMB的值
+func GetMediaCacheQuotaMB() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil || instance.Settings.MediaCacheQuotaMB <= 0 {
+		return 256
+	}
+	return instance.Settings.MediaCacheQuotaMB
+}
+
+// 获取MessageRetention的值 未设置时为10000,负数为不限制(返回0)
+func GetMessageRetention() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil || instance.Settings.MessageRetention == 0 {
+		return 10000
+	}
+	if instance.Settings.MessageRetention < 0 {
+		return 0
+	}
+	return instance.Settings.MessageRetention
+}
+
+// 获取MediaLinks的值
+func GetMediaLinks() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		mylog.Println("Warning: instance is nil when trying to MediaLinks value.")
+		return false
+	}
+	return instance.Settings.MediaLinks
+}
+
+// 获取MarkdownTemplateDir的值,为空时不使用本地模板
+func GetMarkdownTemplateDir() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		return ""
+	}
+	return instance.Settings.MarkdownTemplateDir
+}
+
+// 获取FixturesFile的值,为空时使用默认的模拟数据
+func GetFixturesFile() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		return ""
+	}
+	return instance.Settings.FixturesFile
+}
+
+// 获取EnableWsServer的值
+func GetEnableWsServer() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		mylog.Println("Warning: instance is nil when trying to EnableWsServer value.")
+		return false
+	}
+	return instance.Settings.EnableWsServer
+}
+
+// 获取WsServerAddress的值
+func GetWsServerAddress() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		return ""
+	}
+	return instance.Settings.WsServerAddress
+}
+
+// 获取WsServerToken的值
+func GetWsServerToken() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		return ""
+	}
+	return instance.Settings.WsServerToken
+}
+
+// 获取WsServerAllowedOrigins的值
+func GetWsServerAllowedOrigins() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		return nil
+	}
+	return instance.Settings.WsServerAllowedOrigins
+}
+
+// 获取HttpAddress的值
+func GetHttpAddress() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		return ""
+	}
+	return instance.Settings.HttpAddress
+}
+
+// 获取HttpAccessToken的值
+func GetHttpAccessToken() string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		return ""
+	}
+	return instance.Settings.HttpAccessToken
+}
+
+// 获取HttpAllowedOrigins的值
+func GetHttpAllowedOrigins() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if instance == nil {
+		return nil
+	}
+	return instance.Settings.HttpAllowedOrigins
+}
@@ -0,0 +1,122 @@
+package cq
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/hoshinonyaruko/gensokyo-mcp/mylog"
+)
+
+// ToArray 将消息段转换为数组格式的消息,来自数组格式的非字符串参数保持原有类型,
+// CQ码中以json文本传递的 node content 还原为消息段数组
+func ToArray(segments []Segment) []map[string]interface{} {
+	array := make([]map[string]interface{}, 0, len(segments))
+	for _, segment := range segments {
+		data := make(map[string]interface{}, len(segment.Data))
+		for key, value := range segment.Data {
+			data[key] = arrayValue(segment, key, value)
+		}
+		array = append(array, map[string]interface{}{
+			"type": segment.Type,
+			"data": data,
+		})
+	}
+	return array
+}
+
+// FromArray 将数组格式的消息(或单个消息段)转换为消息段,
+// 非字符串参数在 Data 中转换为字符串(对象与数组为json文本),原始值保存在 Values
+func FromArray(message interface{}) []Segment {
+	var segments []Segment
+	switch message := message.(type) {
+	case []interface{}:
+		for _, item := range message {
+			if segmentMap, ok := item.(map[string]interface{}); ok {
+				if segment, ok := fromMap(segmentMap); ok {
+					segments = append(segments, segment)
+				}
+			}
+		}
+	case []map[string]interface{}:
+		for _, segmentMap := range message {
+			if segment, ok := fromMap(segmentMap); ok {
+				segments = append(segments, segment)
+			}
+		}
+	case map[string]interface{}:
+		if segment, ok := fromMap(message); ok {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
+
+// ParseMessage 解析 params.message,支持CQ码字符串与数组格式
+func ParseMessage(message interface{}) []Segment {
+	if str, ok := message.(string); ok {
+		return Parse(str)
+	}
+	return FromArray(message)
+}
+
+func fromMap(segmentMap map[string]interface{}) (Segment, bool) {
+	segmentType, ok := segmentMap["type"].(string)
+	if !ok {
+		return Segment{}, false
+	}
+	segment := Segment{Type: segmentType, Data: make(map[string]string)}
+	data, _ := segmentMap["data"].(map[string]interface{})
+	for key, value := range data {
+		segment.Data[key] = Stringify(value)
+		if _, ok := value.(string); !ok && value != nil {
+			if segment.Values == nil {
+				segment.Values = make(map[string]interface{})
+			}
+			segment.Values[key] = value
+		}
+	}
+	return segment, true
+}
+
+// arrayValue 返回参数在数组格式中的值,Data 被修改过时以 Data 为准
+func arrayValue(segment Segment, key, value string) interface{} {
+	if original, ok := segment.Values[key]; ok && Stringify(original) == value {
+		return original
+	}
+	if segment.Type == "node" && key == "content" && strings.HasPrefix(value, "[") {
+		var content []interface{}
+		if json.Unmarshal([]byte(value), &content) == nil {
+			return content
+		}
+	}
+	return value
+}
+
+// Stringify 将参数转换为字符串,对象与数组保存为json文本
+func Stringify(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case bool:
+		return strconv.FormatBool(v)
+	case nil:
+		return ""
+	default:
+		// 不转义 & < >,保持与应用端发送的json文本一致
+		var b strings.Builder
+		encoder := json.NewEncoder(&b)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(v); err != nil {
+			mylog.Printf("Error marshaling segment data: %v", err)
+			return ""
+		}
+		return strings.TrimSuffix(b.String(), "\n")
+	}
+}
@@ -0,0 +1,102 @@
+package cq
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// toInterfaces 模拟应用端数组消息经json解码后的形式
+func toInterfaces(array []map[string]interface{}) []interface{} {
+	items := make([]interface{}, 0, len(array))
+	for _, item := range array {
+		items = append(items, item)
+	}
+	return items
+}
+
+// decodeJSON 解码测试用的数组消息
+func decodeJSON(t *testing.T, message string) interface{} {
+	t.Helper()
+	var value interface{}
+	if err := json.Unmarshal([]byte(message), &value); err != nil {
+		t.Fatalf("unmarshal %s: %v", message, err)
+	}
+	return value
+}
+
+// mustJSON 按键名排序输出json,用于比较
+func mustJSON(t *testing.T, value interface{}) string {
+	t.Helper()
+	var b strings.Builder
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// TestArrayRoundTrip 数组格式经消息段转换回数组格式后保持原样,嵌套与非字符串参数不被转换为字符串
+func TestArrayRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+	}{
+		{
+			name:    "text with escapes",
+			message: `[{"type":"text","data":{"text":"a[b] &#91; & c,d"}}]`,
+		},
+		{
+			name:    "scalar params keep their types",
+			message: `[{"type":"reply","data":{"id":12345}},{"type":"face","data":{"id":"14"}},{"type":"at","data":{"qq":"all"}},{"type":"dice","data":{"result":6,"visible":true}}]`,
+		},
+		{
+			name:    "node with nested content",
+			message: `[{"type":"node","data":{"name":"小明","uin":"10001","content":[{"type":"text","data":{"text":"嵌套"}},{"type":"image","data":{"file":"https://example.com/a.png?x=1&y=2"}}]}}]`,
+		},
+		{
+			name:    "node with nested forward",
+			message: `[{"type":"node","data":{"name":"外层","uin":10001,"content":[{"type":"node","data":{"name":"内层","uin":10002,"content":[{"type":"text","data":{"text":"最内层"}}]}}]}}]`,
+		},
+		{
+			name:    "keyboard object",
+			message: `[{"type":"keyboard","data":{"content":{"rows":[{"buttons":[{"render_data":{"label":"签到"},"action":{"type":2,"data":"/签到"}}]}]}}}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := decodeJSON(t, tt.message)
+			got := mustJSON(t, ToArray(FromArray(message)))
+			if want := mustJSON(t, message); got != want {
+				t.Errorf("ToArray(FromArray())\n got: %s\nwant: %s", got, want)
+			}
+		})
+	}
+}
+
+// TestArrayNodeFromString CQ码中以json文本传递的 node content 转换为数组格式时还原为消息段数组
+func TestArrayNodeFromString(t *testing.T) {
+	// json 的键按名称排序,再编码时与原消息逐字节一致
+	message := `[CQ:node,content=&#91;{"data":{"text":"嵌套&amp;#44;"}&#44;"type":"text"}&#93;,name=小明,uin=10001]`
+	got := mustJSON(t, ToArray(Parse(message)))
+	want := `[{"data":{"content":[{"data":{"text":"嵌套&#44;"},"type":"text"}],"name":"小明","uin":"10001"},"type":"node"}]`
+	if got != want {
+		t.Fatalf("ToArray\n got: %s\nwant: %s", got, want)
+	}
+
+	// 再转换为CQ码与原消息一致
+	if back := Encode(FromArray(decodeJSON(t, got))); back != message {
+		t.Errorf("Encode(FromArray())\n got: %q\nwant: %q", back, message)
+	}
+}
+
+// TestArrayModifiedData Data 被修改后以修改后的值为准
+func TestArrayModifiedData(t *testing.T) {
+	segments := FromArray(decodeJSON(t, `[{"type":"reply","data":{"id":12345}}]`))
+	segments[0].Data["id"] = "678"
+	if got, want := mustJSON(t, ToArray(segments)), `[{"data":{"id":"678"},"type":"reply"}]`; got != want {
+		t.Fatalf("ToArray\n got: %s\nwant: %s", got, want)
+	}
+}
@@ -0,0 +1,154 @@
+// Package cq 解析与生成 OneBot v11 的CQ码,并在字符串与数组两种消息格式间转换
+package cq
+
+import (
+	"sort"
+	"strings"
+)
+
+// Segment 一个消息段,Data 中的参数均为未转义的原始值
+type Segment struct {
+	Type string
+	Data map[string]string
+	// Values 数组格式中非字符串参数的原始值(数字、对象、数组等),ToArray 时原样输出
+	Values map[string]interface{}
+}
+
+// Text 创建文本段
+func Text(text string) Segment {
+	return Segment{Type: "text", Data: map[string]string{"text": text}}
+}
+
+// Get 返回段参数,不存在时为空
+func (s Segment) Get(key string) string {
+	return s.Data[key]
+}
+
+var (
+	textEscaper  = strings.NewReplacer("&", "&amp;", "[", "&#91;", "]", "&#93;")
+	paramEscaper = strings.NewReplacer("&", "&amp;", "[", "&#91;", "]", "&#93;", ",", "&#44;")
+	unescaper    = strings.NewReplacer("&#91;", "[", "&#93;", "]", "&#44;", ",", "&amp;", "&")
+)
+
+// EscapeText 转义纯文本中的 & [ ]
+func EscapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+// EscapeParam 转义参数值中的 & [ ] ,
+func EscapeParam(s string) string {
+	return paramEscaper.Replace(s)
+}
+
+// Unescape 还原转义,文本与参数值通用
+func Unescape(s string) string {
+	return unescaper.Replace(s)
+}
+
+// Parse 将CQ码字符串按出现顺序拆分为消息段,相邻的文本合并为一个文本段,
+// 不合法的CQ码按文本处理
+func Parse(message string) []Segment {
+	var segments []Segment
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			segments = append(segments, Text(Unescape(text.String())))
+			text.Reset()
+		}
+	}
+
+	for len(message) > 0 {
+		start := strings.Index(message, "[CQ:")
+		if start < 0 {
+			text.WriteString(message)
+			break
+		}
+		text.WriteString(message[:start])
+		message = message[start:]
+
+		end := strings.IndexByte(message, ']')
+		segment, ok := Segment{}, false
+		if end >= 0 {
+			segment, ok = parseCode(message[len("[CQ:"):end])
+		}
+		if !ok {
+			// 不是CQ码,保留 "[CQ:" 后继续查找
+			text.WriteString(message[:len("[CQ:")])
+			message = message[len("[CQ:"):]
+			continue
+		}
+
+		flush()
+		segments = append(segments, segment)
+		message = message[end+1:]
+	}
+	flush()
+
+	return segments
+}
+
+// parseCode 解析 type,key=value,... 形式的CQ码内容
+func parseCode(code string) (Segment, bool) {
+	parts := strings.Split(code, ",")
+	if !validType(parts[0]) {
+		return Segment{}, false
+	}
+	segment := Segment{Type: parts[0], Data: make(map[string]string, len(parts)-1)}
+	for _, part := range parts[1:] {
+		key, value, _ := strings.Cut(part, "=")
+		if key == "" {
+			return Segment{}, false
+		}
+		segment.Data[key] = Unescape(value)
+	}
+	return segment, true
+}
+
+// validType 段类型只能由字母、数字、下划线、点与连字符组成
+func validType(segmentType string) bool {
+	if segmentType == "" {
+		return false
+	}
+	for _, r := range segmentType {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '.', r == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// EncodeSegment 将消息段转换为CQ码,文本段转换为转义后的文本,参数按键名排序
+func EncodeSegment(segment Segment) string {
+	if segment.Type == "text" {
+		return EscapeText(segment.Get("text"))
+	}
+
+	keys := make([]string, 0, len(segment.Data))
+	for key := range segment.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString("[CQ:")
+	b.WriteString(segment.Type)
+	for _, key := range keys {
+		b.WriteByte(',')
+		b.WriteString(key)
+		b.WriteByte('=')
+		b.WriteString(EscapeParam(segment.Data[key]))
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+// Encode 将消息段转换为CQ码字符串
+func Encode(segments []Segment) string {
+	var b strings.Builder
+	for _, segment := range segments {
+		b.WriteString(EncodeSegment(segment))
+	}
+	return b.String()
+}
@@ -0,0 +1,71 @@
+package cq
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestParseEncodeRoundTrip 转义后的文本与参数解析后还原为原值,再次编码得到相同的CQ码
+func TestParseEncodeRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    []Segment
+	}{
+		{
+			name:    "escaped text",
+			message: "a&#91;b&#93; &amp; c",
+			want:    []Segment{Text("a[b] & c")},
+		},
+		{
+			name:    "escaped params",
+			message: "前[CQ:share,title=x&#44;y&#91;1&#93;&amp;z,url=https://example.com/?a=1&amp;b=2]后",
+			want: []Segment{
+				Text("前"),
+				{Type: "share", Data: map[string]string{"title": "x,y[1]&z", "url": "https://example.com/?a=1&b=2"}},
+				Text("后"),
+			},
+		},
+		{
+			name:    "escaped json param",
+			message: `[CQ:node,content=&#91;{"type":"text"&#44;"data":{"text":"&amp;#91;"}}&#93;,name=小明]`,
+			want: []Segment{
+				{Type: "node", Data: map[string]string{"content": `[{"type":"text","data":{"text":"&#91;"}}]`, "name": "小明"}},
+			},
+		},
+		{
+			name:    "invalid code kept as text",
+			message: "[CQ:] &#91;CQ:face&#44;id=1&#93;",
+			want:    []Segment{Text("[CQ:] [CQ:face,id=1]")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Parse(tt.message)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Parse\n got: %#v\nwant: %#v", got, tt.want)
+			}
+			if encoded := Encode(got); Encode(Parse(encoded)) != encoded {
+				t.Errorf("Encode is not stable: %q", encoded)
+			}
+			// 经过数组格式再转换,内容不变(json参数的键顺序可能改变,按数组格式比较)
+			array := ToArray(got)
+			if back := ToArray(FromArray(toInterfaces(array))); mustJSON(t, back) != mustJSON(t, array) {
+				t.Errorf("array round trip\n got: %s\nwant: %s", mustJSON(t, back), mustJSON(t, array))
+			}
+		})
+	}
+}
+
+// TestEncodeEscapes 文本只转义 & [ ],参数额外转义逗号
+func TestEncodeEscapes(t *testing.T) {
+	segments := []Segment{
+		Text("a,b[c]&d"),
+		{Type: "image", Data: map[string]string{"file": "a,b[c]&d"}},
+	}
+	want := "a,b&#91;c&#93;&amp;d[CQ:image,file=a&#44;b&#91;c&#93;&amp;d]"
+	if got := Encode(segments); got != want {
+		t.Fatalf("Encode\n got: %q\nwant: %q", got, want)
+	}
+}
@@ -0,0 +1,180 @@
+// 模拟数据 查询类api按模拟数据文件响应
+package fixtures
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/hoshinonyaruko/gensokyo-mcp/mylog"
+	"github.com/hoshinonyaruko/gensokyo-mcp/template"
+	"gopkg.in/yaml.v3"
+)
+
+// Fixtures 模拟数据文件的内容
+type Fixtures struct {
+	Self    Profile  `yaml:"self"`
+	Version Version  `yaml:"version"`
+	Groups  []Group  `yaml:"groups"`
+	Friends []Friend `yaml:"friends"`
+	Guilds  []Guild  `yaml:"guilds"`
+}
+
+// Profile 机器人自身资料,user_id 为配置中的 uin
+type Profile struct {
+	Nickname string `yaml:"nickname"`
+}
+
+// Version 版本信息
+type Version struct {
+	AppName         string `yaml:"app_name"`
+	AppVersion      string `yaml:"app_version"`
+	ProtocolVersion string `yaml:"protocol_version"`
+}
+
+type Group struct {
+	GroupID        string   `yaml:"group_id"`
+	GroupName      string   `yaml:"group_name"`
+	GroupMemo      string   `yaml:"group_memo"`
+	MemberCount    int      `yaml:"member_count"`
+	MaxMemberCount int      `yaml:"max_member_count"`
+	Members        []Member `yaml:"members"`
+}
+
+// Member 群成员 Role 为 owner admin member
+type Member struct {
+	UserID   string `yaml:"user_id"`
+	Nickname string `yaml:"nickname"`
+	Card     string `yaml:"card"`
+	Role     string `yaml:"role"`
+	Sex      string `yaml:"sex"`
+	Age      int    `yaml:"age"`
+	Area     string `yaml:"area"`
+	Level    string `yaml:"level"`
+	Title    string `yaml:"title"`
+	JoinTime int64  `yaml:"join_time"`
+	// 最后发言时间,由上报的事件更新
+	LastSentTime int64 `yaml:"last_sent_time"`
+}
+
+type Friend struct {
+	UserID   string `yaml:"user_id"`
+	Nickname string `yaml:"nickname"`
+	Remark   string `yaml:"remark"`
+}
+
+type Guild struct {
+	GuildID        string    `yaml:"guild_id"`
+	GuildName      string    `yaml:"guild_name"`
+	GuildDisplayID string    `yaml:"guild_display_id"`
+	Channels       []Channel `yaml:"channels"`
+}
+
+type Channel struct {
+	ChannelID   string `yaml:"channel_id"`
+	ChannelName string `yaml:"channel_name"`
+	ChannelType int    `yaml:"channel_type"`
+}
+
+var (
+	mu      sync.RWMutex
+	current *Fixtures
+)
+
+// Get 返回当前的模拟数据,未加载时返回默认模拟数据,调用方不应修改返回值
+func Get() *Fixtures {
+	mu.RLock()
+	f := current
+	mu.RUnlock()
+	if f != nil {
+		return f
+	}
+
+	f, err := parse([]byte(template.FixturesTemplate))
+	if err != nil {
+		mylog.Printf("Error parsing default fixtures: %v", err)
+		return &Fixtures{}
+	}
+	mu.Lock()
+	if current == nil {
+		current = f
+	}
+	f = current
+	mu.Unlock()
+	return f
+}
+
+// Load 读取模拟数据文件,文件不存在时写入默认模拟数据
+func Load(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		data = []byte(template.FixturesTemplate)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			mylog.Printf("Error writing default fixtures to %s: %v", path, err)
+		}
+	} else if err != nil {
+		return err
+	}
+
+	f, err := parse(data)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	current = f
+	mu.Unlock()
+	return nil
+}
+
+// Watch 监听模拟数据文件,变动时重新加载,解析失败时保留原有数据
+func Watch(path string) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	// 监听所在目录,编辑器以替换文件的方式保存时也能收到事件
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	target := filepath.Clean(path)
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != target || event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+					continue
+				}
+				if err := Load(path); err != nil {
+					mylog.Printf("Error reloading fixtures %s: %v", path, err)
+					continue
+				}
+				mylog.Printf("检测到模拟数据变动,已重新加载: %s", path)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				mylog.Println("Fixtures watcher error:", err)
+			}
+		}
+	}()
+	return nil
+}
+
+func parse(data []byte) (*Fixtures, error) {
+	var f Fixtures
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	for i := range f.Groups {
+		if f.Groups[i].MemberCount == 0 {
+			f.Groups[i].MemberCount = len(f.Groups[i].Members)
+		}
+	}
+	return &f, nil
+}
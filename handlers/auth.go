@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// CheckAccessToken 校验正向ws与http api的access_token,
+// 支持 Authorization: Bearer/Token <token> 与 ?access_token=,
+// 通过时返回 http.StatusOK,未提供时返回 401,不匹配时返回 403
+func CheckAccessToken(r *http.Request, token string) int {
+	if token == "" {
+		return http.StatusOK
+	}
+
+	provided := r.URL.Query().Get("access_token")
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		if scheme, value, ok := strings.Cut(auth, " "); ok && (strings.EqualFold(scheme, "Bearer") || strings.EqualFold(scheme, "Token")) {
+			provided = strings.TrimSpace(value)
+		}
+	}
+	if provided == "" {
+		return http.StatusUnauthorized
+	}
+	if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+		return http.StatusForbidden
+	}
+	return http.StatusOK
+}
+
+// CheckOrigin 拒绝网页借用户的浏览器发起的跨站请求,
+// 应用端不发送 Origin,同源请求与 allowed 中的来源放行,
+// 配置了access_token时跨站页面无法得到token,不再校验来源
+func CheckOrigin(r *http.Request, token string, allowed []string) bool {
+	if token != "" {
+		return true
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		// 不带 Origin 的浏览器请求(如img标签的GET)以 Sec-Fetch-Site 判断
+		switch r.Header.Get("Sec-Fetch-Site") {
+		case "", "same-origin", "none":
+			return true
+		}
+		return false
+	}
+	for _, o := range allowed {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host != "" && strings.EqualFold(u.Host, r.Host)
+}
@@ -0,0 +1,53 @@
+// 好友类action 按模拟数据与成员目录响应
+package friends
+
+import (
+	"github.com/hoshinonyaruko/gensokyo-mcp/callapi"
+	"github.com/hoshinonyaruko/gensokyo-mcp/fixtures"
+	"github.com/hoshinonyaruko/gensokyo-mcp/handlers"
+	"github.com/hoshinonyaruko/gensokyo-mcp/members"
+	"github.com/hoshinonyaruko/gensokyo-mcp/wsclient"
+)
+
+func init() {
+	callapi.RegisterHandler("get_friend_list", GetFriendList)
+	callapi.RegisterHandler("get_stranger_info", GetStrangerInfo)
+	callapi.RegisterHandler("set_friend_add_request", SetFriendAddRequest)
+}
+
+// GetFriendList 好友列表
+func GetFriendList(client callapi.Client, message callapi.ActionMessage) (string, error) {
+	friends := fixtures.Get().Friends
+	data := make([]map[string]interface{}, 0, len(friends))
+	for _, friend := range friends {
+		data = append(data, map[string]interface{}{
+			"nickname": friend.Nickname,
+			"remark":   friend.Remark,
+			"user_id":  handlers.FormatID(friend.UserID),
+		})
+	}
+	return callapi.SendResponse(client, callapi.OkResponse(data, message.Echo))
+}
+
+// GetStrangerInfo 陌生人信息,未知用户只返回id
+func GetStrangerInfo(client callapi.Client, message callapi.ActionMessage) (string, error) {
+	userID, _ := message.Params.UserID.(string)
+	user, _ := members.Stranger(userID)
+	sex := user.Sex
+	if sex == "" {
+		sex = "unknown"
+	}
+	return callapi.SendResponse(client, callapi.OkResponse(map[string]interface{}{
+		"user_id":  handlers.FormatID(userID),
+		"nickname": user.Nickname,
+		"sex":      sex,
+		"age":      user.Age,
+	}, message.Echo))
+}
+
+// SetFriendAddRequest 处理加好友请求,回执后投递给上报该请求的调用
+func SetFriendAddRequest(client callapi.Client, message callapi.ActionMessage) (string, error) {
+	response, err := callapi.SendResponse(client, callapi.OkResponse(nil, message.Echo))
+	wsclient.DispatchRequestReply(message)
+	return response, err
+}
@@ -0,0 +1,122 @@
+// 群类action 按模拟数据与成员目录响应
+package groups
+
+import (
+	"fmt"
+
+	"github.com/hoshinonyaruko/gensokyo-mcp/callapi"
+	"github.com/hoshinonyaruko/gensokyo-mcp/fixtures"
+	"github.com/hoshinonyaruko/gensokyo-mcp/handlers"
+	"github.com/hoshinonyaruko/gensokyo-mcp/members"
+)
+
+func init() {
+	callapi.RegisterHandler("get_group_list", GetGroupList)
+	callapi.RegisterHandler("get_group_info", GetGroupInfo)
+	callapi.RegisterHandler("get_group_member_info", GetGroupMemberInfo)
+	callapi.RegisterHandler("get_group_member_list", GetGroupMemberList)
+	callapi.RegisterHandler("get_group_honor_info", GetGroupHonorInfo)
+}
+
+// GetGroupList 群列表
+func GetGroupList(client callapi.Client, message callapi.ActionMessage) (string, error) {
+	groups := fixtures.Get().Groups
+	data := make([]map[string]interface{}, 0, len(groups))
+	for _, group := range groups {
+		data = append(data, groupInfo(group))
+	}
+	return callapi.SendResponse(client, callapi.OkResponse(data, message.Echo))
+}
+
+// GetGroupInfo 群信息
+func GetGroupInfo(client callapi.Client, message callapi.ActionMessage) (string, error) {
+	groupID, _ := message.Params.GroupID.(string)
+	group, ok := members.Group(groupID)
+	if !ok {
+		return callapi.SendResponse(client, callapi.FailedResponse(100, "group not found: "+groupID, message.Echo))
+	}
+	return callapi.SendResponse(client, callapi.OkResponse(groupInfo(group), message.Echo))
+}
+
+// GetGroupMemberInfo 群成员信息
+func GetGroupMemberInfo(client callapi.Client, message callapi.ActionMessage) (string, error) {
+	groupID, _ := message.Params.GroupID.(string)
+	userID, _ := message.Params.UserID.(string)
+	member, ok := members.Member(groupID, userID)
+	if !ok {
+		return callapi.SendResponse(client, callapi.FailedResponse(100, fmt.Sprintf("member %s not found in group %s", userID, groupID), message.Echo))
+	}
+	return callapi.SendResponse(client, callapi.OkResponse(memberInfo(groupID, member), message.Echo))
+}
+
+// GetGroupMemberList 群成员列表
+func GetGroupMemberList(client callapi.Client, message callapi.ActionMessage) (string, error) {
+	groupID, _ := message.Params.GroupID.(string)
+	if _, ok := members.Group(groupID); !ok {
+		return callapi.SendResponse(client, callapi.FailedResponse(100, "group not found: "+groupID, message.Echo))
+	}
+	list := members.Members(groupID)
+	data := make([]map[string]interface{}, 0, len(list))
+	for _, member := range list {
+		data = append(data, memberInfo(groupID, member))
+	}
+	return callapi.SendResponse(client, callapi.OkResponse(data, message.Echo))
+}
+
+// GetGroupHonorInfo 群荣誉信息,荣誉列表均为空
+func GetGroupHonorInfo(client callapi.Client, message callapi.ActionMessage) (string, error) {
+	groupID, _ := message.Params.GroupID.(string)
+	if _, ok := members.Group(groupID); !ok {
+		return callapi.SendResponse(client, callapi.FailedResponse(100, "group not found: "+groupID, message.Echo))
+	}
+	return callapi.SendResponse(client, callapi.OkResponse(map[string]interface{}{
+		"group_id":           handlers.FormatID(groupID),
+		"current_talkative":  nil,
+		"talkative_list":     []interface{}{},
+		"performer_list":     []interface{}{},
+		"legend_list":        []interface{}{},
+		"strong_newbie_list": []interface{}{},
+		"emotion_list":       []interface{}{},
+	}, message.Echo))
+}
+
+// groupInfo 群信息
+func groupInfo(group fixtures.Group) map[string]interface{} {
+	return map[string]interface{}{
+		"group_create_time": 0,
+		"group_id":          handlers.FormatID(group.GroupID),
+		"group_level":       0,
+		"group_memo":        group.GroupMemo,
+		"group_name":        group.GroupName,
+		"max_member_count":  group.MaxMemberCount,
+		"member_count":      group.MemberCount,
+	}
+}
+
+// memberInfo 群成员信息
+func memberInfo(groupID string, member fixtures.Member) map[string]interface{} {
+	return map[string]interface{}{
+		"group_id":          handlers.FormatID(groupID),
+		"user_id":           handlers.FormatID(member.UserID),
+		"nickname":          member.Nickname,
+		"card":              member.Card,
+		"sex":               defaultString(member.Sex, "unknown"),
+		"age":               member.Age,
+		"area":              member.Area,
+		"join_time":         member.JoinTime,
+		"last_sent_time":    member.LastSentTime,
+		"level":             member.Level,
+		"role":              defaultString(member.Role, "member"),
+		"unfriendly":        false,
+		"title":             member.Title,
+		"title_expire_time": 0,
+		"card_changeable":   false,
+	}
+}
+
+func defaultString(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,45 @@
+package groups
+
+import (
+	"github.com/hoshinonyaruko/gensokyo-mcp/callapi"
+	"github.com/hoshinonyaruko/gensokyo-mcp/fixtures"
+)
+
+func init() {
+	callapi.RegisterHandler("get_guild_list", GetGuildList)
+	callapi.RegisterHandler("get_guild_channel_list", GetGuildChannelList)
+}
+
+// GetGuildList 频道列表,频道id始终为string
+func GetGuildList(client callapi.Client, message callapi.ActionMessage) (string, error) {
+	guilds := fixtures.Get().Guilds
+	data := make([]map[string]interface{}, 0, len(guilds))
+	for _, guild := range guilds {
+		data = append(data, map[string]interface{}{
+			"guild_id":         guild.GuildID,
+			"guild_name":       guild.GuildName,
+			"guild_display_id": guild.GuildDisplayID,
+		})
+	}
+	return callapi.SendResponse(client, callapi.OkResponse(data, message.Echo))
+}
+
+// GetGuildChannelList 子频道列表,找不到频道时为空列表
+func GetGuildChannelList(client callapi.Client, message callapi.ActionMessage) (string, error) {
+	guildID, _ := message.Params.GuildID.(string)
+	data := []map[string]interface{}{}
+	for _, guild := range fixtures.Get().Guilds {
+		if guild.GuildID != guildID {
+			continue
+		}
+		for _, channel := range guild.Channels {
+			data = append(data, map[string]interface{}{
+				"guild_id":     guild.GuildID,
+				"channel_id":   channel.ChannelID,
+				"channel_name": channel.ChannelName,
+				"channel_type": channel.ChannelType,
+			})
+		}
+	}
+	return callapi.SendResponse(client, callapi.OkResponse(data, message.Echo))
+}
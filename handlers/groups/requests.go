@@ -0,0 +1,17 @@
+package groups
+
+import (
+	"github.com/hoshinonyaruko/gensokyo-mcp/callapi"
+	"github.com/hoshinonyaruko/gensokyo-mcp/wsclient"
+)
+
+func init() {
+	callapi.RegisterHandler("set_group_add_request", SetGroupAddRequest)
+}
+
+// SetGroupAddRequest 处理加群请求,回执后投递给上报该请求的调用
+func SetGroupAddRequest(client callapi.Client, message callapi.ActionMessage) (string, error) {
+	response, err := callapi.SendResponse(client, callapi.OkResponse(nil, message.Echo))
+	wsclient.DispatchRequestReply(message)
+	return response, err
+}
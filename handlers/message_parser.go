@@ -5,86 +5,42 @@ import (
 	"fmt"
 	"log"
 	"strconv"
-	"strings"
 
 	"github.com/hoshinonyaruko/gensokyo-mcp/callapi"
-	"github.com/hoshinonyaruko/gensokyo-mcp/wsclient"
+	"github.com/hoshinonyaruko/gensokyo-mcp/config"
+	"github.com/hoshinonyaruko/gensokyo-mcp/cq"
 	//xurls是一个从文本提取url的库 适用于多种场景
 )
 
 var BotID string
 var AppID string
 
-// 定义响应结构体
-type ServerResponse struct {
-	Data struct {
-		MessageID int `json:"message_id"`
-	} `json:"data"`
-	Message string      `json:"message"`
-	RetCode int         `json:"retcode"`
-	Status  string      `json:"status"`
-	Echo    interface{} `json:"echo"`
-}
-
-// SendResponse 向所有连接的WebSocket客户端广播回执信息
-func SendResponse(Wsclient []*wsclient.WebSocketClient, err error, message *callapi.ActionMessage) (string, error) {
-	// 初始化响应结构体
-	response := ServerResponse{}
-	response.Data.MessageID = 123 // TODO: 实现messageID转换
-	response.Echo = message.Echo
+// SendResponse 向发起调用的连接发送 send 类 action 的回执,messageID 为分配给bot消息的id
+func SendResponse(client callapi.Client, messageID interface{}, message *callapi.ActionMessage) (string, error) {
+	response := callapi.OkResponse(map[string]interface{}{"message_id": messageID}, message.Echo)
+	jsonResponse, err := callapi.SendResponse(client, response)
 	if err != nil {
-		response.Message = err.Error()
-		response.RetCode = 0 // 示例中将错误情况也视为操作成功
-		response.Status = "ok"
-	} else {
-		response.Message = "操作成功"
-		response.RetCode = 0
-		response.Status = "ok"
-	}
-
-	// 将响应结构体转换为JSON字符串
-	jsonResponse, jsonErr := json.Marshal(response)
-	if jsonErr != nil {
-		log.Printf("Error marshaling response to JSON: %v", jsonErr)
-		return "", jsonErr
-	}
-
-	// 准备发送的消息
-	messageMap := make(map[string]interface{})
-	if err := json.Unmarshal(jsonResponse, &messageMap); err != nil {
-		log.Printf("Error unmarshaling JSON response: %v", err)
+		log.Printf("Error sending response of %s: %v", message.Action, err)
 		return "", err
 	}
-
-	// 广播消息到所有Wsclient
-	broadcastErr := broadcastMessageToAll(messageMap, Wsclient)
-	if broadcastErr != nil {
-		log.Printf("Error broadcasting message to all clients: %v", broadcastErr)
-		return "", broadcastErr
-	}
-
-	log.Printf("发送成功回执: %+v", string(jsonResponse))
-	return string(jsonResponse), nil
+	return jsonResponse, nil
 }
 
-// 方便快捷的发信息函数
-func broadcastMessageToAll(message map[string]interface{}, Wsclient []*wsclient.WebSocketClient) error {
-	var errors []string
-
-	// 发送到我们作为客户端的Wsclient
-	for _, client := range Wsclient {
-		//mylog.Printf("第%v个Wsclient", test)
-		err := client.SendMessage(message)
-		if err != nil {
-			errors = append(errors, fmt.Sprintf("error sending private message via wsclient: %v", err))
-		}
+// FormatID string_ob11 模式下以string返回id,否则以int返回
+func FormatID(id string) interface{} {
+	if config.GetStringOb11() {
+		return id
 	}
+	intID, _ := strconv.ParseInt(id, 10, 64)
+	return intID
+}
 
-	// 在循环结束后处理记录的错误
-	if len(errors) > 0 {
-		return fmt.Errorf(strings.Join(errors, "; "))
+// FormatMessageID string_ob11 模式下以string返回 message_id,否则以int返回
+func FormatMessageID(messageID int) interface{} {
+	if config.GetStringOb11() {
+		return strconv.Itoa(messageID)
 	}
-	return nil
+	return messageID
 }
 
 // allEmpty checks if all the strings in the slice are empty.
@@ -111,26 +67,22 @@ func ConvertMapToJSONString(m map[string]interface{}) (string, error) {
 	return jsonString, nil
 }
 
-// 将收到的data.content转换为message segment todo,群场景不支持受图片,频道场景的图片可以拼一下
+// ConvertToSegmentedMessage 将payload中的CQ码转换为对应的消息段,其余内容为文本段
 func ConvertToSegmentedMessage(data string) []map[string]interface{} {
-
-	var messageSegments []map[string]interface{}
-
-	// 内容被视为文本部分
-	if data != "" {
-		textSegment := map[string]interface{}{
-			"type": "text",
-			"data": map[string]interface{}{
-				"text": data,
-			},
-		}
-		messageSegments = append(messageSegments, textSegment)
-	}
+	messageSegments := cq.ToArray(cq.Parse(data))
 	//排列
-	messageSegments = sortMessageSegments(messageSegments)
+	if config.GetSortSegments() {
+		messageSegments = sortMessageSegments(messageSegments)
+	}
 	return messageSegments
 }
 
+// NormalizeRawMessage 将payload转换为规范的CQ码字符串,用作 raw_message
+// 未转义的 & [ ] 会被转义,已有的CQ码保持不变
+func NormalizeRawMessage(data string) string {
+	return cq.Encode(cq.Parse(data))
+}
+
 // ConvertToInt64 尝试将 interface{} 类型的值转换为 int64 类型
 func ConvertToInt64(value interface{}) (int64, error) {
 	switch v := value.(type) {
@@ -146,9 +98,9 @@ func ConvertToInt64(value interface{}) (int64, error) {
 	}
 }
 
-// 排列MessageSegments
+// 排列MessageSegments at,文本,图片在前,其他消息段保持原顺序排在最后
 func sortMessageSegments(segments []map[string]interface{}) []map[string]interface{} {
-	var atSegments, textSegments, imageSegments []map[string]interface{}
+	var atSegments, textSegments, imageSegments, otherSegments []map[string]interface{}
 
 	for _, segment := range segments {
 		switch segment["type"] {
@@ -158,9 +110,11 @@ func sortMessageSegments(segments []map[string]interface{}) []map[string]interfa
 			textSegments = append(textSegments, segment)
 		case "image":
 			imageSegments = append(imageSegments, segment)
+		default:
+			otherSegments = append(otherSegments, segment)
 		}
 	}
 
 	// 按照指定的顺序合并这些切片
-	return append(append(atSegments, textSegments...), imageSegments...)
+	return append(append(append(atSegments, textSegments...), imageSegments...), otherSegments...)
 }
@@ -0,0 +1,57 @@
+package messages
+
+import (
+	"github.com/hoshinonyaruko/gensokyo-mcp/botstats"
+	"github.com/hoshinonyaruko/gensokyo-mcp/callapi"
+	"github.com/hoshinonyaruko/gensokyo-mcp/config"
+	"github.com/hoshinonyaruko/gensokyo-mcp/cq"
+	"github.com/hoshinonyaruko/gensokyo-mcp/handlers"
+)
+
+func init() {
+	callapi.RegisterHandler("get_msg", GetMsg)
+	callapi.RegisterHandler("delete_msg", DeleteMsg)
+}
+
+// GetMsg 获取消息,消息内容按上报格式(CQ码或数组)返回
+func GetMsg(client callapi.Client, message callapi.ActionMessage) (string, error) {
+	echo := message.Echo
+	messageID, err := botstats.ParseMessageID(message.Params.MessageID)
+	if err != nil {
+		return callapi.SendResponse(client, callapi.FailedResponse(100, err.Error(), echo))
+	}
+	record, err := botstats.GetMessage(messageID)
+	if err != nil {
+		return callapi.SendResponse(client, callapi.FailedResponse(100, err.Error(), echo))
+	}
+
+	var content interface{} = cq.Encode(cq.ParseMessage(record.Message))
+	if config.GetArrayValue() {
+		content = cq.ToArray(cq.ParseMessage(record.Message))
+	}
+	data := map[string]interface{}{
+		"time":         record.Time,
+		"message_type": record.MessageType,
+		"message_id":   handlers.FormatMessageID(record.MessageID),
+		"real_id":      handlers.FormatMessageID(record.MessageID),
+		"sender":       record.Sender,
+		"message":      content,
+	}
+	if record.GroupID != "" {
+		data["group_id"] = handlers.FormatID(record.GroupID)
+	}
+	return callapi.SendResponse(client, callapi.OkResponse(data, echo))
+}
+
+// DeleteMsg 撤回消息,撤回后的消息不能再通过 get_msg 获取
+func DeleteMsg(client callapi.Client, message callapi.ActionMessage) (string, error) {
+	echo := message.Echo
+	messageID, err := botstats.ParseMessageID(message.Params.MessageID)
+	if err != nil {
+		return callapi.SendResponse(client, callapi.FailedResponse(100, err.Error(), echo))
+	}
+	if err := botstats.DeleteMessage(messageID); err != nil {
+		return callapi.SendResponse(client, callapi.FailedResponse(100, err.Error(), echo))
+	}
+	return callapi.SendResponse(client, callapi.OkResponse(nil, echo))
+}
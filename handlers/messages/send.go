@@ -0,0 +1,71 @@
+// 消息类action 发送、获取与撤回消息
+package messages
+
+import (
+	"encoding/json"
+
+	"github.com/hoshinonyaruko/gensokyo-mcp/botstats"
+	"github.com/hoshinonyaruko/gensokyo-mcp/callapi"
+	"github.com/hoshinonyaruko/gensokyo-mcp/config"
+	"github.com/hoshinonyaruko/gensokyo-mcp/fixtures"
+	"github.com/hoshinonyaruko/gensokyo-mcp/handlers"
+	"github.com/hoshinonyaruko/gensokyo-mcp/mylog"
+	"github.com/hoshinonyaruko/gensokyo-mcp/wsclient"
+)
+
+func init() {
+	for _, action := range []string{
+		"send_msg",
+		"send_group_msg",
+		"send_private_msg",
+		"send_forward_msg",
+		"send_group_forward_msg",
+		"send_private_forward_msg",
+		"send_guild_channel_msg",
+	} {
+		callapi.RegisterHandler(action, SendMessage)
+	}
+}
+
+// SendMessage 保存bot发出的消息并回执 message_id,然后按会话投递给等待中的调用
+func SendMessage(client callapi.Client, message callapi.ActionMessage) (string, error) {
+	messageID := saveBotMessage(message)
+	response, err := handlers.SendResponse(client, handlers.FormatMessageID(messageID), &message)
+
+	wsclient.DispatchReply(uint64(config.GetUinint64()), message)
+	return response, err
+}
+
+// saveBotMessage 为bot发出的消息分配 message_id 并保存,返回分配的id,失败时为0
+func saveBotMessage(message callapi.ActionMessage) int {
+	messageID, err := botstats.NextMessageID()
+	if err != nil {
+		mylog.Printf("Error allocating message_id: %v", err)
+		return 0
+	}
+
+	messageType := "group"
+	if wsclient.IsPrivateAction(message) {
+		messageType = "private"
+	}
+	content := message.Params.Message
+	if content == nil {
+		// 合并转发的节点在 messages 中
+		content = message.Params.Messages
+	}
+	userID, _ := message.Params.UserID.(string)
+	groupID, _ := message.Params.GroupID.(string)
+	if messageType == "private" {
+		groupID = ""
+	}
+	action, _ := json.Marshal(message)
+
+	sender := map[string]interface{}{
+		"user_id":  config.GetUinint64(),
+		"nickname": fixtures.Get().Self.Nickname,
+	}
+	if err := botstats.SaveBotMessage(messageID, messageType, userID, groupID, sender, content, action); err != nil {
+		mylog.Printf("Error saving message %d: %v", messageID, err)
+	}
+	return messageID
+}
@@ -0,0 +1,67 @@
+// 元信息类action 机器人资料、版本与在线状态
+package meta
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/hoshinonyaruko/gensokyo-mcp/callapi"
+	"github.com/hoshinonyaruko/gensokyo-mcp/config"
+	"github.com/hoshinonyaruko/gensokyo-mcp/fixtures"
+)
+
+func init() {
+	callapi.RegisterHandler("get_login_info", GetLoginInfo)
+	callapi.RegisterHandler("get_version_info", GetVersionInfo)
+	callapi.RegisterHandler("get_guild_service_profile", GetGuildServiceProfile)
+	callapi.RegisterHandler("get_online_clients", GetOnlineClients)
+}
+
+// GetLoginInfo 机器人自身资料,user_id 为配置中的 uin
+func GetLoginInfo(client callapi.Client, message callapi.ActionMessage) (string, error) {
+	return callapi.SendResponse(client, callapi.OkResponse(map[string]interface{}{
+		"nickname": fixtures.Get().Self.Nickname,
+		"user_id":  config.GetUinint64(),
+	}, message.Echo))
+}
+
+// GetVersionInfo 版本信息,运行环境取实际值,
+// 保留 go-cqhttp 的兼容字段,部分应用端据此判断支持的功能
+func GetVersionInfo(client callapi.Client, message callapi.ActionMessage) (string, error) {
+	version := fixtures.Get().Version
+	return callapi.SendResponse(client, callapi.OkResponse(map[string]interface{}{
+		"app_full_name":              fmt.Sprintf("%s-%s_%s_%s-%s", version.AppName, version.AppVersion, runtime.GOOS, runtime.GOARCH, runtime.Version()),
+		"app_name":                   version.AppName,
+		"app_version":                version.AppVersion,
+		"coolq_directory":            "",
+		"coolq_edition":              "pro",
+		"go-cqhttp":                  true,
+		"plugin_build_configuration": "release",
+		"plugin_build_number":        99,
+		"plugin_version":             "4.15.0",
+		"protocol_name":              4,
+		"protocol_version":           version.ProtocolVersion,
+		"runtime_os":                 runtime.GOOS,
+		"runtime_version":            runtime.Version(),
+		"version":                    version.AppVersion,
+	}, message.Echo))
+}
+
+// GetGuildServiceProfile 频道系统内的机器人资料
+func GetGuildServiceProfile(client callapi.Client, message callapi.ActionMessage) (string, error) {
+	return callapi.SendResponse(client, callapi.OkResponse(map[string]interface{}{
+		"nickname": fixtures.Get().Self.Nickname,
+		"tiny_id":  0,
+	}, message.Echo))
+}
+
+// GetOnlineClients 当前账号在线的其他客户端,始终为空
+func GetOnlineClients(client callapi.Client, message callapi.ActionMessage) (string, error) {
+	response := callapi.OkResponse(map[string]interface{}{
+		"clients": []interface{}{},
+		"tiny_id": 0,
+	}, message.Echo)
+	// 部分应用端从响应顶层读取 clients
+	response["clients"] = []interface{}{}
+	return callapi.SendResponse(client, response)
+}
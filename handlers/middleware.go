@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo-mcp/botstats"
+	"github.com/hoshinonyaruko/gensokyo-mcp/callapi"
+	"github.com/hoshinonyaruko/gensokyo-mcp/config"
+	"github.com/hoshinonyaruko/gensokyo-mcp/multid"
+	"github.com/hoshinonyaruko/gensokyo-mcp/mylog"
+)
+
+// ActionStat 单个action的调用统计
+type ActionStat struct {
+	Calls  int64 `json:"calls"`
+	Errors int64 `json:"errors"`
+}
+
+// unsupportedAction 未注册的action统一计入此项,避免统计随应用端发来的任意action名增长
+const unsupportedAction = "unsupported"
+
+var (
+	actionStatsMu sync.Mutex
+	actionStats   = make(map[string]*ActionStat)
+)
+
+// ActionStats 返回各action的调用统计
+func ActionStats() map[string]ActionStat {
+	actionStatsMu.Lock()
+	defer actionStatsMu.Unlock()
+	stats := make(map[string]ActionStat, len(actionStats))
+	for action, stat := range actionStats {
+		stats[action] = *stat
+	}
+	return stats
+}
+
+// LoggingMiddleware 记录action调用与耗时
+func LoggingMiddleware(action string, next callapi.HandlerFunc) callapi.HandlerFunc {
+	return func(client callapi.Client, message callapi.ActionMessage) (string, error) {
+		start := time.Now()
+		response, err := next(client, message)
+		if err != nil {
+			mylog.Printf("Action '%s' failed in %v: %v", action, time.Since(start), err)
+		} else {
+			mylog.Printf("Responded to action '%s' in %v with: %s", action, time.Since(start), response)
+		}
+		return response, err
+	}
+}
+
+// MetricsMiddleware 统计action调用次数,send类action计入发出的消息数
+func MetricsMiddleware(action string, next callapi.HandlerFunc) callapi.HandlerFunc {
+	return func(client callapi.Client, message callapi.ActionMessage) (string, error) {
+		response, err := next(client, message)
+
+		key := action
+		if !callapi.IsRegistered(action) {
+			key = unsupportedAction
+		}
+		actionStatsMu.Lock()
+		stat, ok := actionStats[key]
+		if !ok {
+			stat = &ActionStat{}
+			actionStats[key] = stat
+		}
+		stat.Calls++
+		if err != nil {
+			stat.Errors++
+		}
+		actionStatsMu.Unlock()
+
+		if err == nil && key == action && strings.HasPrefix(action, "send_") && strings.HasSuffix(action, "_msg") {
+			botstats.RecordMessageSent()
+		}
+		return response, err
+	}
+}
+
+// IDConversionMiddleware string模式下将绑定后的 user_id 还原为原始id
+func IDConversionMiddleware(action string, next callapi.HandlerFunc) callapi.HandlerFunc {
+	return func(client callapi.Client, message callapi.ActionMessage) (string, error) {
+		if config.GetStringOb11() {
+			if userID, ok := message.Params.UserID.(string); ok && userID != "" {
+				message.Params.UserID = multid.GetOriginIDFromActiveID(userID)
+			}
+		}
+		return next(client, message)
+	}
+}
@@ -0,0 +1,184 @@
+// http api 应用端以 POST /<action> 或 GET /<action>?参数 调用api
+package httpapi
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/hoshinonyaruko/gensokyo-mcp/callapi"
+	"github.com/hoshinonyaruko/gensokyo-mcp/config"
+	"github.com/hoshinonyaruko/gensokyo-mcp/handlers"
+	"github.com/hoshinonyaruko/gensokyo-mcp/mylog"
+)
+
+// maxBodySize 请求体的最大体积
+const maxBodySize = 10 << 20
+
+// 表单与查询参数中非字符串的字段,按 ParamsContent 中的类型转换
+var (
+	intFields  = map[string]bool{"duration": true}
+	boolFields = map[string]bool{"enable": true, "approve": true}
+)
+
+// HttpAPIClient 一次http调用,记录handler发出的响应
+type HttpAPIClient struct {
+	response map[string]interface{}
+}
+
+// SendMessage 记录响应,由 serve 写回
+func (c *HttpAPIClient) SendMessage(message map[string]interface{}) error {
+	c.response = message
+	return nil
+}
+
+// Handler http api的路由,action 取自路径
+func Handler() http.Handler {
+	return http.HandlerFunc(serve)
+}
+
+// ListenAndServe 在 address 上启动http api
+func ListenAndServe(address string) error {
+	mylog.Printf("http api已启动: http://%s", address)
+	return http.ListenAndServe(address, Handler())
+}
+
+// serve 校验access_token与请求来源,解析参数后按action分发给注册的handler
+func serve(w http.ResponseWriter, r *http.Request) {
+	token := config.GetHttpAccessToken()
+	if status := handlers.CheckAccessToken(r, token); status != http.StatusOK {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	// 网页中的表单与img标签无需跨域许可即可发出请求,未设置token时拒绝其他网页的请求
+	if !handlers.CheckOrigin(r, token, config.GetHttpAllowedOrigins()) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	action := strings.Trim(r.URL.Path, "/")
+	if action == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	params, status := parseParams(r)
+	if status != http.StatusOK {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	// 经过与ws相同的 ActionMessage 解析,id 等字段的兼容处理保持一致
+	raw, err := json.Marshal(map[string]interface{}{"action": action, "params": params})
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	var message callapi.ActionMessage
+	if err := json.Unmarshal(raw, &message); err != nil {
+		mylog.Printf("Error unmarshalling http api params: %v, Original params: %s", err, string(raw))
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	mylog.Printf("Received from http api client %s: %s", r.RemoteAddr, string(raw))
+
+	client := &HttpAPIClient{}
+	callapi.CallAPIFromDict(client, message)
+	if client.response == nil {
+		writeJSON(w, http.StatusInternalServerError, callapi.FailedResponse(500, "调用 "+action+" 失败", nil))
+		return
+	}
+
+	status = http.StatusOK
+	if retcode, _ := client.response["retcode"].(int); retcode == 1404 {
+		status = http.StatusNotFound
+	}
+	writeJSON(w, status, client.response)
+}
+
+// parseParams 合并查询参数与请求体中的参数,请求体支持json与表单
+func parseParams(r *http.Request) (map[string]interface{}, int) {
+	params := make(map[string]interface{})
+	addValues(params, r.URL.Query())
+
+	if r.Method != http.MethodPost {
+		return params, http.StatusOK
+	}
+
+	r.Body = http.MaxBytesReader(nil, r.Body, maxBodySize)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "", "application/json":
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, http.StatusBadRequest
+		}
+		if len(strings.TrimSpace(string(body))) == 0 {
+			return params, http.StatusOK
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal(body, &fields); err != nil {
+			return nil, http.StatusBadRequest
+		}
+		for key, value := range fields {
+			params[key] = value
+		}
+	case "application/x-www-form-urlencoded":
+		if err := r.ParseForm(); err != nil {
+			return nil, http.StatusBadRequest
+		}
+		addValues(params, r.PostForm)
+	case "multipart/form-data":
+		if err := r.ParseMultipartForm(maxBodySize); err != nil {
+			return nil, http.StatusBadRequest
+		}
+		addValues(params, r.MultipartForm.Value)
+	default:
+		return nil, http.StatusNotAcceptable
+	}
+	return params, http.StatusOK
+}
+
+// addValues 将表单或查询参数加入params,同名参数取第一个
+func addValues(params map[string]interface{}, values url.Values) {
+	for key, list := range values {
+		if key == "access_token" || len(list) == 0 {
+			continue
+		}
+		params[key] = formValue(key, list[0])
+	}
+}
+
+// formValue 表单中的值都是字符串,数字与布尔字段转换为对应类型
+func formValue(key, value string) interface{} {
+	switch {
+	case intFields[key]:
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	case boolFields[key]:
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return value
+}
+
+// writeJSON 写回响应,http调用没有echo
+func writeJSON(w http.ResponseWriter, status int, response map[string]interface{}) {
+	delete(response, "echo")
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		mylog.Printf("Error writing http api response: %v", err)
+	}
+}
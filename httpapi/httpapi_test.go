@@ -0,0 +1,97 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hoshinonyaruko/gensokyo-mcp/callapi"
+	"github.com/hoshinonyaruko/gensokyo-mcp/config"
+	"github.com/hoshinonyaruko/gensokyo-mcp/template"
+)
+
+func init() {
+	callapi.RegisterHandler("test_echo", func(client callapi.Client, message callapi.ActionMessage) (string, error) {
+		return callapi.SendResponse(client, callapi.OkResponse(message.Params.Message, message.Echo))
+	})
+}
+
+// loadTestConfig 以默认配置加载,token 与允许的来源替换为给定值
+func loadTestConfig(t *testing.T, token, allowedOrigins string) {
+	t.Helper()
+	conf := strings.Replace(template.ConfigTemplate, `http_access_token : ""`, `http_access_token : "`+token+`"`, 1)
+	conf = strings.Replace(conf, `http_allowed_origins : []`, `http_allowed_origins : `+allowedOrigins, 1)
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(conf), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.LoadConfig(path, false); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// formPost 以表单调用 test_echo,headers 为成对的请求头
+func formPost(t *testing.T, server *httptest.Server, headers ...string) int {
+	t.Helper()
+	body := url.Values{"message": {"hi"}}.Encode()
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/test_echo", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+// TestServeAuth 未设置token时拒绝其他网页的表单与跨站请求,设置token后按token校验
+func TestServeAuth(t *testing.T) {
+	server := httptest.NewServer(Handler())
+	defer server.Close()
+
+	loadTestConfig(t, "", `["http://allowed.example"]`)
+	noToken := []struct {
+		name    string
+		headers []string
+		want    int
+	}{
+		{"app without origin", nil, http.StatusOK},
+		{"same origin page", []string{"Origin", server.URL}, http.StatusOK},
+		{"allowed origin", []string{"Origin", "http://allowed.example"}, http.StatusOK},
+		{"foreign form post", []string{"Origin", "http://evil.example"}, http.StatusForbidden},
+		{"cross-site request without origin", []string{"Sec-Fetch-Site", "cross-site"}, http.StatusForbidden},
+		{"same-site request without origin", []string{"Sec-Fetch-Site", "same-site"}, http.StatusForbidden},
+	}
+	for _, tt := range noToken {
+		if got := formPost(t, server, tt.headers...); got != tt.want {
+			t.Errorf("no token, %s: status %d, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	loadTestConfig(t, "secret", `[]`)
+	withToken := []struct {
+		name    string
+		headers []string
+		want    int
+	}{
+		{"missing token", nil, http.StatusUnauthorized},
+		{"wrong token", []string{"Authorization", "Bearer nope"}, http.StatusForbidden},
+		{"token", []string{"Authorization", "Bearer secret"}, http.StatusOK},
+		{"token from foreign origin", []string{"Authorization", "Bearer secret", "Origin", "http://evil.example"}, http.StatusOK},
+	}
+	for _, tt := range withToken {
+		if got := formPost(t, server, tt.headers...); got != tt.want {
+			t.Errorf("with token, %s: status %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -2,22 +2,33 @@ package images
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"image"
 	"image/color"
 	"image/draw"
 	"image/gif"
 	"image/jpeg"
-	"image/png"
+	_ "image/png" // register PNG decoder
 	"io"
 	"sync"
 )
 
+// MaxPixels is the largest width*height that will be decoded. Decoding and
+// downscaling need up to two full-size RGBA buffers (8 bytes per pixel), so a
+// tiny file declaring a huge canvas could otherwise exhaust memory. The bound
+// still admits long screenshots such as 1080x20000 so they can be resized.
+const MaxPixels = 40 * 1000 * 1000
+
+// ErrTooManyPixels is returned for images larger than MaxPixels; callers keep the original data.
+var ErrTooManyPixels = errors.New("image dimensions exceed decode limit")
+
 type Compressor struct {
-	QualityStep int // Quality adjustment step
-	MinQuality  int // Minimum quality
-	MaxQuality  int // Maximum quality
-	ThresholdKB int // Size threshold in KB
+	QualityStep  int // Quality adjustment step
+	MinQuality   int // Minimum quality
+	MaxQuality   int // Maximum quality
+	ThresholdKB  int // Size threshold in KB
+	MaxDimension int // Maximum width/height in pixels, 0 means unlimited
 }
 
 func NewCompressor(thresholdKB, qualityStep, minQuality, maxQuality int) *Compressor {
@@ -30,55 +41,68 @@ func NewCompressor(thresholdKB, qualityStep, minQuality, maxQuality int) *Compre
 }
 
 // CompressImage handles image compression based on format.
+// Images within both the size threshold and MaxDimension are returned unchanged.
 func (c *Compressor) CompressImage(imageData io.Reader) ([]byte, error) {
-	if c.ThresholdKB == 0 {
-		return io.ReadAll(imageData)
+	data, err := io.ReadAll(imageData)
+	if err != nil {
+		return nil, fmt.Errorf("reading image failed: %w", err)
+	}
+	if c.ThresholdKB <= 0 && c.MaxDimension <= 0 {
+		return data, nil
 	}
 
-	// Create a buffer to copy the imageData and determine the image format.
-	buffer := bytes.NewBuffer(nil)
-	tee := io.TeeReader(imageData, buffer)
-
-	// Decode image using the buffer so we don't lose the initial bytes.
-	img, format, err := image.Decode(tee)
+	// Check size and dimensions first so small images are never re-encoded.
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
 	if err != nil {
-		return nil, fmt.Errorf("decoding image failed: %w", err)
+		return nil, fmt.Errorf("decoding image config failed: %w", err)
+	}
+	withinSize := c.ThresholdKB <= 0 || len(data) <= c.ThresholdKB*1024
+	if withinSize && fitsDimension(cfg.Width, cfg.Height, c.MaxDimension) {
+		return data, nil
+	}
+	// Refuse to decode before any full-size buffer is allocated.
+	if int64(cfg.Width)*int64(cfg.Height) > MaxPixels {
+		return nil, fmt.Errorf("%w: %dx%d", ErrTooManyPixels, cfg.Width, cfg.Height)
 	}
 
-	// For GIFs, use the buffer which contains all bytes read from the original imageData.
+	// GIF frames are recompressed but not resized, to keep the animation intact.
 	if format == "gif" {
-		return c.handleGIF(buffer)
+		if withinSize {
+			return data, nil
+		}
+		compressed, err := c.handleGIF(bytes.NewReader(data))
+		// Re-encoded frames are often larger than the original palette data.
+		if err != nil || len(compressed) >= len(data) {
+			return data, err
+		}
+		return compressed, nil
 	}
 
-	// For non-GIFs, check the initial size using a fresh buffer.
-	buf := &bytes.Buffer{}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decoding image failed: %w", err)
+	}
+	resized := downscale(img, c.MaxDimension)
+
+	// Apply format-specific compression.
+	var compressed []byte
 	switch format {
 	case "jpeg":
-		err = jpeg.Encode(buf, img, nil)
+		compressed, err = c.compressJPEG(resized)
 	case "png":
-		err = png.Encode(buf, img)
+		compressed, err = c.compressPNG(resized)
 	default:
 		return nil, fmt.Errorf("unsupported image format: %s", format)
 	}
-
 	if err != nil {
-		return nil, fmt.Errorf("encoding image failed: %w", err)
-	}
-
-	if buf.Len() <= c.ThresholdKB*1024 {
-		// If the image is already below the threshold, return the original encoded bytes.
-		return buf.Bytes(), nil
+		return nil, err
 	}
-
-	// Apply format-specific compression.
-	switch format {
-	case "jpeg":
-		return c.compressJPEG(img)
-	case "png":
-		return c.compressPNG(img)
+	// Without a resize, keep the original when re-encoding does not help,
+	// which also keeps PNG transparency.
+	if resized == img && len(compressed) >= len(data) {
+		return data, nil
 	}
-
-	return nil, fmt.Errorf("unsupported image format: %s", format)
+	return compressed, nil
 }
 
 // handleGIF decodes and processes a GIF image.
@@ -102,7 +126,8 @@ func (c *Compressor) compressJPEG(img image.Image) ([]byte, error) {
 			return nil, fmt.Errorf("JPEG encoding failed at quality %d: %w", quality, err)
 		}
 
-		if buf.Len() <= c.ThresholdKB*1024 || quality <= c.MinQuality {
+		// Without a threshold (resize only) the image is encoded once at MaxQuality.
+		if c.ThresholdKB <= 0 || buf.Len() <= c.ThresholdKB*1024 || quality <= c.MinQuality {
 			break
 		}
 
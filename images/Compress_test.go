@@ -0,0 +1,87 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+// encodePNG 编码测试用的png
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// pngHeader 只有签名与 IHDR 的png,用于声明很大的画布而不实际分配像素
+func pngHeader(width, height uint32) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("\x89PNG\r\n\x1a\n")
+	ihdr := make([]byte, 17)
+	copy(ihdr, "IHDR")
+	binary.BigEndian.PutUint32(ihdr[4:], width)
+	binary.BigEndian.PutUint32(ihdr[8:], height)
+	ihdr[12], ihdr[13] = 8, 6 // 8bit RGBA
+	binary.Write(&buf, binary.BigEndian, uint32(13))
+	buf.Write(ihdr)
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(ihdr))
+	return buf.Bytes()
+}
+
+// TestCompressTallScreenshot 长截图在解码上限内,按 MaxDimension 缩小
+func TestCompressTallScreenshot(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 1080, 20000))
+	for y := 0; y < 20000; y += 40 {
+		for x := 0; x < 1080; x++ {
+			img.SetGray(x, y, color.Gray{Y: 255})
+		}
+	}
+	c := &Compressor{MaxQuality: 90, MinQuality: 50, QualityStep: 10, MaxDimension: 2048}
+	got, err := c.CompressImage(bytes.NewReader(encodePNG(t, img)))
+	if err != nil {
+		t.Fatalf("CompressImage: %v", err)
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(got))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Width != 110 || cfg.Height != 2048 {
+		t.Errorf("resized to %dx%d, want 110x2048", cfg.Width, cfg.Height)
+	}
+}
+
+// TestCompressKeepsSmallerOriginal 未缩放且转为jpeg后更大时返回原图,保留png与透明度
+func TestCompressKeepsSmallerOriginal(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 512, 512))
+	for y := 0; y < 512; y++ {
+		for x := 0; x < 512; x += 2 {
+			img.SetNRGBA(x, y, color.NRGBA{A: 255})
+		}
+	}
+	data := encodePNG(t, img)
+	c := &Compressor{ThresholdKB: 1, MaxQuality: 95, MinQuality: 90, QualityStep: 5}
+	got, err := c.CompressImage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("CompressImage: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("got %d bytes, want the original %d byte png", len(got), len(data))
+	}
+}
+
+// TestCompressTooManyPixels 声明的画布超过 MaxPixels 时不解码
+func TestCompressTooManyPixels(t *testing.T) {
+	c := &Compressor{MaxDimension: 2048}
+	_, err := c.CompressImage(bytes.NewReader(pngHeader(50000, 50000)))
+	if !errors.Is(err, ErrTooManyPixels) {
+		t.Fatalf("err = %v, want ErrTooManyPixels", err)
+	}
+}
@@ -2,27 +2,30 @@ package images
 
 import (
 	"bytes"
+
+	"github.com/hoshinonyaruko/gensokyo-mcp/config"
 )
 
 // 默认压缩参数
+// 质量范围由配置 image_min_quality/image_max_quality 决定
 const (
 	defaultQualityStep = 10
-	defaultMinQuality  = 25
-	defaultMaxQuality  = 75
 )
 
-// CompressSingleImage 接收一个图片的 []byte 数据，并根据设定阈值返回压缩后的数据或原始数据。
+// CompressSingleImage 接收一个图片的 []byte 数据，并根据设定阈值与最大边长返回压缩后的数据或原始数据。
 func CompressSingleImage(imageBytes []byte) ([]byte, error) {
-	// 获取压缩阈值
-	thresholdKB := 0
+	// 获取压缩阈值与最大边长
+	thresholdKB := config.GetImageCompressThresholdKB()
+	maxDimension := config.GetImageMaxDimension()
 
-	// 如果阈值为0，则直接返回原始图片数据，不进行压缩
-	if thresholdKB == 0 {
+	// 如果都为0，则直接返回原始图片数据，不进行压缩
+	if thresholdKB == 0 && maxDimension == 0 {
 		return imageBytes, nil
 	}
 
 	// 创建压缩器实例
-	compressor := NewCompressor(thresholdKB, defaultQualityStep, defaultMinQuality, defaultMaxQuality)
+	compressor := NewCompressor(thresholdKB, defaultQualityStep, config.GetImageMinQuality(), config.GetImageMaxQuality())
+	compressor.MaxDimension = maxDimension
 
 	// 创建一个读取器来读取 imageBytes 数据
 	reader := bytes.NewReader(imageBytes)
@@ -0,0 +1,77 @@
+package images
+
+import (
+	"image"
+	"image/draw"
+)
+
+// fitsDimension 判断宽高是否都不超过 maxDimension,maxDimension 为0时不限制
+func fitsDimension(width, height, maxDimension int) bool {
+	return maxDimension <= 0 || (width <= maxDimension && height <= maxDimension)
+}
+
+// downscale 按比例缩小图片,使最长边不超过 maxDimension,采用区域平均采样
+func downscale(img image.Image, maxDimension int) image.Image {
+	b := img.Bounds()
+	srcW, srcH := b.Dx(), b.Dy()
+	if fitsDimension(srcW, srcH, maxDimension) {
+		return img
+	}
+
+	dstW, dstH := maxDimension, maxDimension
+	if srcW >= srcH {
+		dstH = srcH * maxDimension / srcW
+	} else {
+		dstW = srcW * maxDimension / srcH
+	}
+	if dstW < 1 {
+		dstW = 1
+	}
+	if dstH < 1 {
+		dstH = 1
+	}
+
+	// 统一转换为 RGBA 后直接读写像素,已是 RGBA 时不再复制
+	src, ok := img.(*image.RGBA)
+	if !ok || b.Min != (image.Point{}) {
+		src = image.NewRGBA(image.Rect(0, 0, srcW, srcH))
+		draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+
+	for y := 0; y < dstH; y++ {
+		y0 := y * srcH / dstH
+		y1 := (y + 1) * srcH / dstH
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < dstW; x++ {
+			x0 := x * srcW / dstW
+			x1 := (x + 1) * srcW / dstW
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, bl, a, n int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += int(p[0])
+					g += int(p[1])
+					bl += int(p[2])
+					a += int(p[3])
+					n++
+				}
+			}
+
+			d := dst.Pix[y*dst.Stride+x*4 : y*dst.Stride+x*4+4]
+			d[0] = uint8(r / n)
+			d[1] = uint8(g / n)
+			d[2] = uint8(bl / n)
+			d[3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
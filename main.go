@@ -9,12 +9,11 @@ import (
 	"errors"
 	"flag"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
-	"regexp"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -22,10 +21,20 @@ import (
 	"github.com/hoshinonyaruko/gensokyo-mcp/botstats"
 	"github.com/hoshinonyaruko/gensokyo-mcp/callapi"
 	"github.com/hoshinonyaruko/gensokyo-mcp/config"
+	"github.com/hoshinonyaruko/gensokyo-mcp/fixtures"
+	"github.com/hoshinonyaruko/gensokyo-mcp/handlers"
+	_ "github.com/hoshinonyaruko/gensokyo-mcp/handlers/friends"
+	_ "github.com/hoshinonyaruko/gensokyo-mcp/handlers/groups"
+	_ "github.com/hoshinonyaruko/gensokyo-mcp/handlers/messages"
+	_ "github.com/hoshinonyaruko/gensokyo-mcp/handlers/meta"
+	"github.com/hoshinonyaruko/gensokyo-mcp/httpapi"
+	"github.com/hoshinonyaruko/gensokyo-mcp/media"
 	"github.com/hoshinonyaruko/gensokyo-mcp/praser"
+	"github.com/hoshinonyaruko/gensokyo-mcp/reply"
 	"github.com/hoshinonyaruko/gensokyo-mcp/sys"
 	"github.com/hoshinonyaruko/gensokyo-mcp/template"
 	"github.com/hoshinonyaruko/gensokyo-mcp/wsclient"
+	"github.com/hoshinonyaruko/gensokyo-mcp/wsserver"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 	"gopkg.in/fsnotify.v1"
@@ -34,6 +43,9 @@ import (
 // 消息处理器，持有 openapi 对象
 var wsClients []*wsclient.WebSocketClient
 
+// 媒体缓存,未开启时为nil
+var mediaCache *media.Cache
+
 // ---------- Context helpers ----------
 
 type bearerKey struct{}
@@ -55,6 +67,64 @@ func bearerFromEnv(ctx context.Context) context.Context {
 
 // ---------- MCP server wrapper ----------
 
+// routeSerialNote 等待回复的工具的共同说明:bot的回复不一定引用触发它的消息,
+// 因此同一会话的调用依次进行
+const routeSerialNote = "同一群(私聊为同一用户)的调用依次进行,前一次调用结束(收集模式下为bot静默)后才开始下一次,其间没有引用消息的回复计入当前的调用."
+
+// 等待回复的工具共用的参数,各工具的说明保持一致
+
+// withTimeoutOption 首条回复的等待超时
+func withTimeoutOption() mcp.ToolOption {
+	return mcp.WithNumber("timeout",
+		mcp.Description("可选：首条回复等待超时，单位秒，最小 1，默认取配置 timeOut，受服务端 max_timeout 限制"),
+		mcp.Min(1),
+	)
+}
+
+// withCollectOption 是否收集多条回复
+func withCollectOption() mcp.ToolOption {
+	return mcp.WithBoolean("collect",
+		mcp.Description("可选：是否收集多条回复直到bot静默，默认取配置 collect_replies"),
+	)
+}
+
+// withCollectTuningOptions 收集模式的静默窗口、最长时间与最多条数
+func withCollectTuningOptions() mcp.ToolOption {
+	options := []mcp.ToolOption{
+		mcp.WithNumber("collect_window",
+			mcp.Description("可选：收集模式下的静默窗口，单位毫秒，默认取配置 collect_window"),
+			mcp.Min(1),
+		),
+		mcp.WithNumber("collect_max_wait",
+			mcp.Description("可选：收集模式下的最长收集时间，单位秒，默认取配置 collect_max_wait"),
+			mcp.Min(1),
+		),
+		mcp.WithNumber("collect_max_messages",
+			mcp.Description("可选：收集模式下最多收集的回复条数，默认取配置 collect_max_messages"),
+			mcp.Min(1),
+		),
+	}
+	return func(tool *mcp.Tool) {
+		for _, option := range options {
+			option(tool)
+		}
+	}
+}
+
+// withAcceptAudioOption 语音以音频内容还是文本描述返回
+func withAcceptAudioOption() mcp.ToolOption {
+	return mcp.WithBoolean("accept_audio",
+		mcp.Description("可选：是否以音频内容返回语音回复，为 false 时返回格式与时长的文本描述，默认取配置 audio_as_text 的相反值"),
+	)
+}
+
+// withMediaLinksOption 以资源链接代替内联的媒体
+func withMediaLinksOption() mcp.ToolOption {
+	return mcp.WithBoolean("media_links",
+		mcp.Description("可选：以 onebot-media://sha256/... 资源链接代替内联的图片与语音，需开启 media_cache，默认取配置 media_links"),
+	)
+}
+
 type GensokyoServer struct {
 	srv *server.MCPServer
 }
@@ -68,7 +138,7 @@ func NewGensokyoServer() *GensokyoServer {
 	)
 
 	wsTool := mcp.NewTool("call_ws",
-		mcp.WithDescription("连接目标 Onebot Ws 调用bot并取得回复."),
+		mcp.WithDescription("连接目标 Onebot Ws 调用bot并取得回复."+routeSerialNote),
 		mcp.WithString("payload",
 			mcp.Description("可选：发送到服务器的文本负载"),
 			mcp.DefaultString("帮助"),
@@ -81,18 +151,175 @@ func NewGensokyoServer() *GensokyoServer {
 			mcp.Description("可选：测试使用的group_id"),
 			mcp.DefaultString("0"),
 		),
-		mcp.WithNumber("timeout",
-			mcp.Description("连接与首条消息读取超时，单位秒，默认 10"),
-			mcp.DefaultNumber(10),
-			mcp.Min(1),
+		withTimeoutOption(),
+		withCollectOption(),
+		withCollectTuningOptions(),
+		withAcceptAudioOption(),
+		withMediaLinksOption(),
+	)
+
+	privateTool := mcp.NewTool("call_ws_private",
+		mcp.WithDescription("连接目标 Onebot Ws 以私聊身份调用bot并取得回复."+routeSerialNote),
+		mcp.WithString("payload",
+			mcp.Description("可选：发送到服务器的文本负载"),
+			mcp.DefaultString("帮助"),
+		),
+		mcp.WithString("user_id",
+			mcp.Description("可选：测试使用的user_id"),
+			mcp.DefaultString("0"),
+		),
+		mcp.WithString("nickname",
+			mcp.Description("可选：发送者昵称"),
+			mcp.DefaultString(""),
+		),
+		mcp.WithString("sub_type",
+			mcp.Description("可选：私聊子类型 friend 好友 group 群临时会话 other 其他"),
+			mcp.DefaultString("friend"),
+			mcp.Enum("friend", "group", "other"),
+		),
+		withTimeoutOption(),
+		withCollectOption(),
+		withCollectTuningOptions(),
+		withAcceptAudioOption(),
+		withMediaLinksOption(),
+	)
+
+	buttonTool := mcp.NewTool("click_button",
+		mcp.WithDescription("按下bot回复中的按钮.指令按钮会把按钮数据作为下一条消息发送,回调按钮会上报按钮回调事件,并取得bot的回复."+routeSerialNote),
+		mcp.WithString("button_id",
+			mcp.Required(),
+			mcp.Description("按钮id,来自回复结果中按钮列表或 _meta.keyboards 的 btn_ 开头的id"),
+		),
+		mcp.WithString("user_id",
+			mcp.Description("可选：按下按钮的user_id"),
+			mcp.DefaultString("0"),
+		),
+		mcp.WithString("group_id",
+			mcp.Description("可选：按钮所在的group_id，为 0 时视为私聊按钮"),
+			mcp.DefaultString("0"),
+		),
+		withTimeoutOption(),
+		withCollectOption(),
+		withAcceptAudioOption(),
+		withMediaLinksOption(),
+	)
+
+	noticeTool := mcp.NewTool("send_notice",
+		mcp.WithDescription("向 Onebot Ws 上报通知事件(入群、退群、禁言、戳一戳、撤回、添加好友)并取得bot的回复."+routeSerialNote),
+		mcp.WithString("notice_type",
+			mcp.Required(),
+			mcp.Description("通知类型"),
+			mcp.Enum("group_increase", "group_decrease", "group_ban", "poke", "group_recall", "friend_recall", "friend_add"),
+		),
+		mcp.WithString("sub_type",
+			mcp.Description("可选：子类型 group_increase: approve/invite, group_decrease: leave/kick/kick_me, group_ban: ban/lift_ban"),
+		),
+		mcp.WithString("user_id",
+			mcp.Description("可选：事件涉及的用户(入群者、被禁言者、戳人者、消息发送者)"),
+			mcp.DefaultString("0"),
+		),
+		mcp.WithString("group_id",
+			mcp.Description("可选：群号，poke 为 0 时视为好友戳一戳"),
+			mcp.DefaultString("0"),
+		),
+		mcp.WithString("operator_id",
+			mcp.Description("可选：操作者，默认与 user_id 相同"),
+		),
+		mcp.WithString("target_id",
+			mcp.Description("可选：poke 被戳者，默认为机器人自己"),
+		),
+		mcp.WithString("message_id",
+			mcp.Description("可选：group_recall/friend_recall 被撤回的消息id，默认为该群(该用户)最近一条消息"),
+		),
+		mcp.WithNumber("duration",
+			mcp.Description("可选：group_ban 禁言时长，单位秒，默认 600"),
+			mcp.Min(0),
+		),
+		withTimeoutOption(),
+		withCollectOption(),
+		withAcceptAudioOption(),
+		withMediaLinksOption(),
+	)
+
+	requestTool := mcp.NewTool("send_request",
+		mcp.WithDescription("向 Onebot Ws 上报加好友/加群请求事件,返回bot对请求的处理结果与回复."+routeSerialNote),
+		mcp.WithString("request_type",
+			mcp.Required(),
+			mcp.Description("请求类型 friend 加好友 group 加群"),
+			mcp.Enum("friend", "group"),
+		),
+		mcp.WithString("sub_type",
+			mcp.Description("可选：group 请求的子类型 add 加群申请 invite 邀请机器人入群，默认 add"),
+			mcp.Enum("add", "invite"),
+		),
+		mcp.WithString("user_id",
+			mcp.Description("可选：发送请求的用户"),
+			mcp.DefaultString("0"),
+		),
+		mcp.WithString("group_id",
+			mcp.Description("可选：group 请求的群号"),
+			mcp.DefaultString("0"),
+		),
+		mcp.WithString("comment",
+			mcp.Description("可选：验证信息"),
+			mcp.DefaultString(""),
 		),
+		withTimeoutOption(),
+		withCollectOption(),
 	)
 
 	// 可以add 多个tool
 	s.AddTool(wsTool, callWS)
+	s.AddTool(privateTool, callWSPrivate)
+	s.AddTool(buttonTool, clickButton)
+	s.AddTool(noticeTool, sendNotice)
+	s.AddTool(requestTool, sendRequest)
 	return &GensokyoServer{srv: s}
 }
 
+// registerMediaResources 将媒体缓存发布为资源,缓存增删时同步资源列表
+func (g *GensokyoServer) registerMediaResources(cache *media.Cache) {
+	mediaTemplate := mcp.NewResourceTemplate(media.CacheURIPrefix+"{hash}", "onebot-media",
+		mcp.WithTemplateDescription("bot回复中的图片/语音缓存,按 sha256 寻址"),
+	)
+	g.srv.AddResourceTemplate(mediaTemplate, readMediaResource)
+
+	for _, entry := range cache.Entries() {
+		g.addMediaResource(entry)
+	}
+	cache.OnAdd = g.addMediaResource
+	cache.OnEvict = func(entry media.CacheEntry) {
+		g.srv.RemoveResource(entry.URI())
+	}
+}
+
+func (g *GensokyoServer) addMediaResource(entry media.CacheEntry) {
+	resource := mcp.NewResource(entry.URI(), entry.Hash[:12],
+		mcp.WithMIMEType(entry.MIMEType),
+		mcp.WithResourceDescription(fmt.Sprintf("%s %d bytes", entry.MIMEType, entry.Size)),
+	)
+	g.srv.AddResource(resource, readMediaResource)
+}
+
+// readMediaResource 读取缓存的媒体
+func readMediaResource(ctx context.Context, req mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	hash, ok := media.HashFromURI(req.Params.URI)
+	if !ok || mediaCache == nil {
+		return nil, fmt.Errorf("invalid media uri: %s", req.Params.URI)
+	}
+	data, entry, err := mediaCache.Get(hash)
+	if err != nil {
+		return nil, err
+	}
+	return []mcp.ResourceContents{
+		mcp.BlobResourceContents{
+			URI:      entry.URI(),
+			MIMEType: entry.MIMEType,
+			Blob:     base64.StdEncoding.EncodeToString(data),
+		},
+	}, nil
+}
+
 func (g *GensokyoServer) HTTPServer() *server.StreamableHTTPServer {
 	return server.NewStreamableHTTPServer(
 		g.srv,
@@ -147,9 +374,52 @@ func main() {
 
 	//创建botstats数据库
 	botstats.InitializeDB()
+	botstats.SetMessageRetention(config.GetMessageRetention())
+
+	// action 中间件 日志 统计 id转换
+	callapi.Use(handlers.LoggingMiddleware, handlers.MetricsMiddleware, handlers.IDConversionMiddleware)
+
+	// 模拟数据 修改后自动重载
+	if fixturesFile := config.GetFixturesFile(); fixturesFile != "" {
+		if err := fixtures.Load(fixturesFile); err != nil {
+			log.Printf("Error loading fixtures %s: %v", fixturesFile, err)
+		}
+		if err := fixtures.Watch(fixturesFile); err != nil {
+			log.Printf("Error watching fixtures %s: %v", fixturesFile, err)
+		}
+	}
+
+	// 媒体缓存,以资源形式发布
+	if config.GetMediaCache() {
+		cache, err := media.NewCache(config.GetMediaCacheDir(), int64(config.GetMediaCacheQuotaMB())*1024*1024)
+		if err != nil {
+			log.Printf("Error opening media cache: %v", err)
+		} else {
+			mediaCache = cache
+			s.registerMediaResources(cache)
+		}
+	}
 
 	sys.SetTitle(conf.Settings.Title)
 
+	// 正向ws服务器
+	if config.GetEnableWsServer() {
+		go func() {
+			if err := wsserver.ListenAndServe(config.GetWsServerAddress()); err != nil {
+				log.Printf("Error starting ws server: %v", err)
+			}
+		}()
+	}
+
+	// http api
+	if config.GetHttpAddress() != "" {
+		go func() {
+			if err := httpapi.ListenAndServe(config.GetHttpAddress()); err != nil {
+				log.Printf("Error starting http api: %v", err)
+			}
+		}()
+	}
+
 	// 启动多个WebSocket客户端的逻辑
 	if !allEmpty(conf.Settings.WsAddress) {
 		wsClientChan := make(chan *wsclient.WebSocketClient, len(conf.Settings.WsAddress))
@@ -293,6 +563,7 @@ func setupConfigWatcher(configFilePath string) {
 					fmt.Println("检测到配置文件变动:", event.Name)
 					//fileLoader.LoadConfigF(configFilePath)
 					config.LoadConfig(configFilePath, true)
+					botstats.SetMessageRetention(config.GetMessageRetention())
 				}
 			case err, ok := <-watcher.Errors:
 				if !ok {
@@ -326,10 +597,11 @@ func allEmpty(addresses []string) bool {
 func callWS(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	// ---------- 1. 解析参数 ----------
 	var args struct {
-		Payload string `json:"payload"`
-		UserID  string `json:"user_id"`
-		GroupID string `json:"group_id"`
-		Timeout int    `json:"timeout"`
+		Payload string  `json:"payload"`
+		UserID  string  `json:"user_id"`
+		GroupID string  `json:"group_id"`
+		Timeout float64 `json:"timeout"`
+		replyOptions
 	}
 	if err := req.BindArguments(&args); err != nil {
 		return mcp.NewToolResultErrorFromErr("参数解析失败", err), err
@@ -339,204 +611,400 @@ func callWS(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult,
 		args.Payload = "帮助"
 	}
 
-	fmt.Printf("receive:%s \n", args.Payload)
+	log.Printf("receive:%s", args.Payload)
 
 	PrintCallToolRequestAsJSON(req)
 
 	// ---------- 3. 业务逻辑 ----------
-	// 异步发送群聊消息；bearer 已确保有值
-	go Processor.ProcessGroupMessage(req, wsClients)
+	key := wsclient.ConversationKey{
+		SelfID:      strconv.FormatInt(config.GetUinint64(), 10),
+		MessageType: "group",
+		GroupID:     normalizeID(args.GroupID),
+		UserID:      normalizeID(args.UserID),
+	}
+	return dispatchAndAwait(key, resolveTimeout(args.Timeout), args.replyOptions, func(messageID int) error {
+		return Processor.ProcessGroupMessage(req, messageID, wsClients)
+	})
+}
 
-	var message *callapi.ActionMessage
-	var err error
-	var resp string
-	// 首先获取超时时间和长查询命令列表
-	timeout := config.GetTimeOut()
+// callWSPrivate 以私聊身份调用bot,经 ProcessC2CMessage 上报私聊事件,
+// 等待对应的 send_private_msg/send_msg 回复并作为工具结果返回。
+func callWSPrivate(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	// ---------- 1. 解析参数 ----------
+	var args struct {
+		Payload  string  `json:"payload"`
+		UserID   string  `json:"user_id"`
+		Nickname string  `json:"nickname"`
+		SubType  string  `json:"sub_type"`
+		Timeout  float64 `json:"timeout"`
+		replyOptions
+	}
+	if err := req.BindArguments(&args); err != nil {
+		return mcp.NewToolResultErrorFromErr("参数解析失败", err), err
+	}
 
-	// 发送消息给WS接口，并等待响应
-	message, err = wsclient.WaitForActionMessage(args.UserID, time.Duration(timeout)*time.Second) // 使用新的超时时间
-	if err != nil {
-		log.Printf("Error waiting for action message: %v", err)
-		resp = "等待超时"
-		return mcp.NewToolResultText(resp), nil
+	switch args.SubType {
+	case "", "friend", "group", "other":
+	default:
+		return mcp.NewToolResultError("sub_type 仅支持 friend group other"), nil
 	}
 
-	var strmessage string
-	// 尝试将message.Params.Message断言为string类型
-	if msgStr, ok := message.Params.Message.(string); ok {
-		strmessage = msgStr
-	} else {
-		// 如果不是string，调用parseMessage函数处理
-		strmessage = praser.ParseMessageContent(message.Params.Message, false)
+	key := wsclient.ConversationKey{
+		SelfID:      strconv.FormatInt(config.GetUinint64(), 10),
+		MessageType: "private",
+		UserID:      normalizeID(args.UserID),
 	}
+	return dispatchAndAwait(key, resolveTimeout(args.Timeout), args.replyOptions, func(messageID int) error {
+		return Processor.ProcessC2CMessage(req, messageID, wsClients)
+	})
+}
 
-	// 调用信息处理函数
-	messageType, resultText, resultImg, err := ProcessMessage(strmessage, message)
-	if err != nil {
-		// 处理错误情况
-		resp = "处理错误"
-		return mcp.NewToolResultText(resp), nil
-	}
-
-	// 根据信息处理函数的返回类型决定如何回复
-	switch messageType {
-	case 1: // 纯文本信息
-		var pendingMsgsToReturn []callapi.ActionMessage
-		if resultStr, ok := resultText.(string); ok {
-			// 获取并叠加历史信息，传入当前字数（这里假设当前字数为0）
-			pendingMsgsToReturn, _, err = wsclient.GetPendingMessages(args.UserID, true, len(resultStr))
-			if err != nil {
-				log.Printf("Error getting pending messages: %v", err)
-				// 如果无法获取历史消息，就直接处理当前的消息
-				pendingMsgsToReturn = nil
-			}
-		}
+// clickButton 按下最近回复中出现过的按钮: 指令按钮以按钮数据作为 payload 调用bot,
+// 回调按钮上报 interaction 事件并等待回复,跳转按钮直接返回链接
+func clickButton(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	var args struct {
+		ButtonID string  `json:"button_id"`
+		UserID   string  `json:"user_id"`
+		GroupID  string  `json:"group_id"`
+		Timeout  float64 `json:"timeout"`
+		replyOptions
+	}
+	if err := req.BindArguments(&args); err != nil {
+		return mcp.NewToolResultErrorFromErr("参数解析失败", err), err
+	}
 
-		// 遍历所有历史消息，并叠加到 result 前
-		for _, message := range pendingMsgsToReturn {
-			var historyContent string
-			// 处理历史消息内容
-			if msgStr, ok := message.Params.Message.(string); ok {
-				historyContent = msgStr
-			} else {
-				// 如果不是string类型，调用parseMessage函数处理
-				historyContent = praser.ParseMessageContent(message.Params.Message, true)
-			}
+	button, ok := reply.LookupButton(args.ButtonID)
+	if !ok {
+		return mcp.NewToolResultError("未找到按钮 " + args.ButtonID + ",按钮id需来自最近的回复结果"), nil
+	}
+	groupID := normalizeID(args.GroupID)
+	if groupID == "0" {
+		groupID = ""
+	}
 
-			// 将历史信息叠加到当前的 result 前
-			resultText = fmt.Sprintf("%s\n-----历史信息----\n%s", historyContent, resultText)
+	switch button.Action.Type {
+	case praser.ActionLink:
+		return mcp.NewToolResultText(fmt.Sprintf("跳转按钮 %s: %s", button.RenderData.Label, button.Action.Data)), nil
+	case praser.ActionCommand:
+		// 与 call_ws / call_ws_private 相同,按钮数据作为消息内容
+		arguments := make(map[string]any)
+		for k, v := range req.GetArguments() {
+			arguments[k] = v
 		}
-		return mcp.NewToolResultText(resultText.(string)), nil
-	case 2: // 纯图片信息
-		imgBase64, err := ImageURLToBase64(resultImg.(string))
-		if err != nil {
-			return nil, err
+		arguments["payload"] = button.Action.Data
+		req.Params.Arguments = arguments
+		if groupID == "" {
+			return callWSPrivate(ctx, req)
 		}
-		return mcp.NewToolResultImage(resultText.(string), imgBase64, "image/jpeg"), nil
+		return callWS(ctx, req)
+	}
 
-	case 4: // 图文信息
-		imgBase64, err := ImageURLToBase64(resultImg.(string))
-		if err != nil {
-			return nil, err
-		}
-		return mcp.NewToolResultImage(resultText.(string), imgBase64, "image/jpeg"), nil
-	// 	case 2: // 纯图片信息
-	// 	return NewToolResultTwoTexts(resultText.(string), resultImg.(string)), nil
-	// case 4: // 图文信息
-	// 	return NewToolResultTwoTexts(resultText.(string), resultImg.(string)), nil
-	default:
-		return mcp.NewToolResultText("未知类型信息"), nil
+	key := wsclient.ConversationKey{
+		SelfID:      strconv.FormatInt(config.GetUinint64(), 10),
+		MessageType: "private",
+		UserID:      normalizeID(args.UserID),
 	}
-	//return mcp.NewToolResultText("无返回值"), nil
+	if groupID != "" {
+		key.MessageType = "group"
+		key.GroupID = groupID
+	}
+	return dispatchAndAwait(key, resolveTimeout(args.Timeout), args.replyOptions, func(eventID int) error {
+		return Processor.ProcessInteraction(key.UserID, groupID, button.ID, button.Action.Data, eventID, wsClients)
+	})
 }
 
-// ProcessMessage 处理信息并归类
-func ProcessMessage(input string, rawMsg *callapi.ActionMessage) (int, interface{}, interface{}, error) {
-	// 正则表达式定义
-	httpUrlImagePattern := regexp.MustCompile(`\[CQ:image,file=http://(.+?)\]`)
-	httpsUrlImagePattern := regexp.MustCompile(`\[CQ:image,file=https://(.+?)\]`)
-	base64ImagePattern := regexp.MustCompile(`\[CQ:image,file=base64://(.+?)\]`)
-	base64RecordPattern := regexp.MustCompile(`\[CQ:record,file=base64://(.+?)\]`)
-	httpUrlRecordPattern := regexp.MustCompile(`\[CQ:record,file=http://(.+?)\]`)
-	httpsUrlRecordPattern := regexp.MustCompile(`\[CQ:record,file=https://(.+?)\]`)
+// sendNotice 上报通知事件,群通知按群路由等待回复,好友通知按用户路由
+func sendNotice(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	var args struct {
+		Processor.NoticeArgs
+		Timeout float64 `json:"timeout"`
+		replyOptions
+	}
+	if err := req.BindArguments(&args); err != nil {
+		return mcp.NewToolResultErrorFromErr("参数解析失败", err), err
+	}
 
-	// 检查是否含有base64编码的图片或语音信息
-	var err error
-	if base64ImagePattern.MatchString(input) || base64RecordPattern.MatchString(input) {
-		input, err = processInput(input)
-		if err != nil {
-			log.Printf("processInput出错:\n%v\n", err)
-		}
-		log.Printf("处理后的base64编码的图片或语音信息:\n%v\n", input)
+	if err := args.ResolveRecall(); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
 	}
 
-	// 检查是否为纯文本信息
-	if !httpUrlImagePattern.MatchString(input) && !httpsUrlImagePattern.MatchString(input) && !httpUrlRecordPattern.MatchString(input) && !httpsUrlRecordPattern.MatchString(input) {
-		// 使用正则表达式匹配并替换[CQ:at,qq=x]格式的信息
-		cqAtPattern := regexp.MustCompile(`\[CQ:at,qq=\d+\]`)
-		// 将匹配到的部分替换为空字符串
-		filteredInput := cqAtPattern.ReplaceAllString(input, "")
+	key := wsclient.ConversationKey{
+		SelfID:      strconv.FormatInt(config.GetUinint64(), 10),
+		MessageType: "private",
+		UserID:      normalizeID(args.UserID),
+	}
+	if args.IsGroupNotice() {
+		key.MessageType = "group"
+		key.GroupID = normalizeID(args.GroupID)
+	}
+	return dispatchAndAwait(key, resolveTimeout(args.Timeout), args.replyOptions, func(int) error {
+		return Processor.ProcessNotice(args.NoticeArgs, wsClients)
+	})
+}
 
-		// 返回过滤后的纯文本信息
-		return 1, filteredInput, nil, nil
+// sendRequest 上报加好友/加群请求,应用端的 set_*_request 与回复消息一并返回
+func sendRequest(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	var args struct {
+		Processor.RequestArgs
+		Timeout float64 `json:"timeout"`
+		replyOptions
+	}
+	if err := req.BindArguments(&args); err != nil {
+		return mcp.NewToolResultErrorFromErr("参数解析失败", err), err
 	}
 
-	// 图片信息处理
-	if httpUrlImagePattern.MatchString(input) || httpsUrlImagePattern.MatchString(input) {
-		// 合并匹配到的所有图片URL
-		httpImageUrls := httpUrlImagePattern.FindAllStringSubmatch(input, -1)
-		httpsImageUrls := httpsUrlImagePattern.FindAllStringSubmatch(input, -1)
+	key := wsclient.ConversationKey{
+		SelfID:      strconv.FormatInt(config.GetUinint64(), 10),
+		MessageType: "private",
+		UserID:      normalizeID(args.UserID),
+	}
+	if args.RequestType == "group" {
+		key.MessageType = "group"
+		key.GroupID = normalizeID(args.GroupID)
+	}
+	return dispatchAndAwait(key, resolveTimeout(args.Timeout), args.replyOptions, func(eventID int) error {
+		wsclient.RegisterRequestFlag(Processor.RequestFlag(eventID), key)
+		return Processor.ProcessRequest(req, eventID, wsClients)
+	})
+}
 
-		// 通过前缀重新构造完整的图片URL
-		var imageUrls []string
-		for _, match := range httpImageUrls {
-			imageUrls = append(imageUrls, "http://"+match[1])
-		}
-		for _, match := range httpsImageUrls {
-			imageUrls = append(imageUrls, "https://"+match[1])
-		}
+// dispatchAndAwait 先登记等待者再上报事件,避免快速回复落入 pendingMessages,
+// 然后等待本次事件引起的回复并转换为工具结果,结果 _meta 中附带超时与耗时
+func dispatchAndAwait(key wsclient.ConversationKey, timeout time.Duration, opts replyOptions, broadcast func(messageID int) error) (*mcp.CallToolResult, error) {
+	start := time.Now()
 
-		// 替换掉所有图片标签
-		input = httpUrlImagePattern.ReplaceAllString(input, "")
-		input = httpsUrlImagePattern.ReplaceAllString(input, "")
+	messageID := Processor.NextMessageID()
+	waiter, err := wsclient.RegisterWaiter(key, strconv.Itoa(messageID), timeout)
+	if err != nil {
+		log.Printf("Error registering waiter: %v", err)
+		return withTimingMeta(mcp.NewToolResultText("等待超时"), timeout, start, true), nil
+	}
+	// 只有收集模式会在首条回复后继续接收,需要等路由静默再交给下一次调用
+	if opts.collect() {
+		waiter.SettleWindow = opts.collectWindow()
+	}
+	defer waiter.Release()
 
-		// 如果替换后内容为空 且只有一个图片
-		if len(imageUrls) == 1 && input == "" {
-			imgUrl := imageUrls[0]
-			return 2, "", imgUrl, nil // 纯图片信息
-		} else {
-			// 图片信息+文本
-			imgUrl := imageUrls[0]
+	if err := broadcast(messageID); err != nil {
+		log.Printf("Error broadcasting message: %v", err)
+	}
 
-			// 将文字部分加入到堆积的事件中
-			//wsclient.AddMessageToPending(rawMsg.Params.UserID.(string), rawMsg)
-			return 2, input, imgUrl, nil // 图文信息
-		}
+	// 超时从上报前开始计算,等待路由释放的时间也计入
+	messages, err := awaitReplies(waiter, timeout-time.Since(start), opts)
+	if err != nil {
+		log.Printf("Error waiting for action message: %v", err)
+		return withTimingMeta(mcp.NewToolResultText("等待超时"), timeout, start, true), nil
 	}
 
-	// 语音信息处理
-	if httpUrlRecordPattern.MatchString(input) || httpsUrlRecordPattern.MatchString(input) {
-		// 初始化变量用于存放处理后的URL
-		var recordUrl string
+	result := renderActionMessages(key.String(), messages, opts)
+	return withTimingMeta(result, timeout, start, false), nil
+}
 
-		// 查找匹配的HTTP URL
-		httpRecordMatches := httpUrlRecordPattern.FindAllStringSubmatch(input, -1)
-		if len(httpRecordMatches) > 0 {
-			// 取第一个匹配项，并添加HTTP前缀
-			recordUrl = "http://" + httpRecordMatches[0][1]
-		}
+// minTimeout 工具参数 timeout 的下限(秒),与工具声明的 Min(1) 一致
+const minTimeout = 1
+
+// resolveTimeout 工具参数 timeout(秒)优先,未传入时使用配置 timeOut,并限制在 1 秒到 max_timeout 之间
+func resolveTimeout(argTimeout float64) time.Duration {
+	seconds := argTimeout
+	if seconds <= 0 {
+		seconds = float64(config.GetTimeOut())
+	}
+	if seconds <= 0 {
+		seconds = 4
+	}
+	if seconds < minTimeout {
+		seconds = minTimeout
+	}
+	if maxTimeout := float64(config.GetMaxTimeOut()); seconds > maxTimeout {
+		seconds = maxTimeout
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// withTimingMeta 在结果 _meta 中记录本次使用的超时与实际耗时
+func withTimingMeta(result *mcp.CallToolResult, timeout time.Duration, start time.Time, timedOut bool) *mcp.CallToolResult {
+	if result.Meta == nil {
+		result.Meta = make(map[string]any)
+	}
+	result.Meta["timeout"] = timeout.Seconds()
+	result.Meta["elapsed_ms"] = time.Since(start).Milliseconds()
+	result.Meta["timed_out"] = timedOut
+	return result
+}
+
+// replyOptions 多条回复收集与回复呈现参数,未传入的字段使用配置默认值
+type replyOptions struct {
+	Collect            *bool `json:"collect"`
+	CollectWindow      *int  `json:"collect_window"`
+	CollectMaxWait     *int  `json:"collect_max_wait"`
+	CollectMaxMessages *int  `json:"collect_max_messages"`
+	AcceptAudio        *bool `json:"accept_audio"`
+	MediaLinks         *bool `json:"media_links"`
+}
+
+// acceptAudio 客户端能否接收音频内容
+func (o replyOptions) acceptAudio() bool {
+	if o.AcceptAudio != nil {
+		return *o.AcceptAudio
+	}
+	return !config.GetAudioAsText()
+}
+
+// collect 是否开启多条回复收集
+func (o replyOptions) collect() bool {
+	if o.Collect != nil {
+		return *o.Collect
+	}
+	return config.GetCollectReplies()
+}
 
-		// 查找匹配的HTTPS URL
-		httpsRecordMatches := httpsUrlRecordPattern.FindAllStringSubmatch(input, -1)
-		if len(httpsRecordMatches) > 0 {
-			// 如果已经找到HTTP URL，优先处理HTTPS URL
-			recordUrl = "https://" + httpsRecordMatches[0][1]
+// collectWindow 收集模式下的静默窗口
+func (o replyOptions) collectWindow() time.Duration {
+	window := config.GetCollectWindow()
+	if o.CollectWindow != nil && *o.CollectWindow > 0 {
+		window = *o.CollectWindow
+	}
+	return time.Duration(window) * time.Millisecond
+}
+
+// mediaLinks 是否以资源链接代替内联媒体,未开启缓存时始终内联
+func (o replyOptions) mediaLinks() bool {
+	if mediaCache == nil {
+		return false
+	}
+	if o.MediaLinks != nil {
+		return *o.MediaLinks
+	}
+	return config.GetMediaLinks()
+}
+
+// awaitReplies 等待本次调用的回复,收集模式下持续收集直到bot静默
+func awaitReplies(waiter *wsclient.Waiter, timeout time.Duration, opts replyOptions) ([]callapi.ActionMessage, error) {
+	if !opts.collect() {
+		message, err := waiter.Wait(timeout)
+		if err != nil {
+			return nil, err
 		}
+		return []callapi.ActionMessage{*message}, nil
+	}
+
+	maxWait := config.GetCollectMaxWait()
+	if opts.CollectMaxWait != nil && *opts.CollectMaxWait > 0 {
+		maxWait = *opts.CollectMaxWait
+	}
+	maxMessages := config.GetCollectMaxMessages()
+	if opts.CollectMaxMessages != nil && *opts.CollectMaxMessages > 0 {
+		maxMessages = *opts.CollectMaxMessages
+	}
+
+	return waiter.Collect(timeout, opts.collectWindow(), time.Duration(maxWait)*time.Second, maxMessages)
+}
+
+// normalizeID 非string_ob11模式下,id以int形式上报,应用端回复时也是int,
+// 这里统一成与回复一致的十进制字符串
+func normalizeID(id string) string {
+	if config.GetStringOb11() {
+		return id
+	}
+	intID, _ := strconv.ParseInt(id, 10, 64)
+	return strconv.FormatInt(intID, 10)
+}
+
+// renderActionMessages 将本次调用收到的一条或多条回复按顺序转换为工具结果,
+// echoKey 用于叠加同一会话中溢出的历史信息。
+func renderActionMessages(echoKey string, messages []callapi.ActionMessage, opts replyOptions) *mcp.CallToolResult {
+	var contents []mcp.Content
+	// 图片数量与体积限制对整个工具结果生效
+	rc := reply.NewContext(opts.acceptAudio(), opts.mediaLinks(), mediaCache)
+	for i := range messages {
+		// 历史信息只叠加到首条回复上
+		contents = append(contents, renderMessageContents(echoKey, &messages[i], i == 0, rc)...)
+	}
+	contents = append(contents, rc.Notes()...)
+	return &mcp.CallToolResult{Content: contents, Result: mcp.Result{Meta: rc.Meta()}}
+}
 
-		// 如果找到了语音URL
-		if recordUrl != "" {
-			mediaId := 0
-			return 3, mediaId, nil, nil // 纯语音信息
+// renderMessageContents 将单条 send 类 action 解析为消息段并渲染为工具结果内容
+func renderMessageContents(echoKey string, message *callapi.ActionMessage, withHistory bool, rc *reply.Context) []mcp.Content {
+	if text, ok := describeRequestAction(message); ok {
+		return []mcp.Content{mcp.NewTextContent(text)}
+	}
+	segments := reply.Parse(message.Params.Message)
+	// send_group_forward_msg 等合并转发的节点在 messages 中
+	if message.Params.Messages != nil {
+		segments = append(segments, reply.ParseForward(message.Params.Messages)...)
+	}
+	contents := reply.Render(rc, segments)
+	// 纯文本回复才叠加历史信息
+	if !withHistory || !reply.IsPlainText(segments) {
+		return contents
+	}
+
+	var resultText string
+	if len(contents) > 0 {
+		if textContent, ok := contents[0].(mcp.TextContent); ok {
+			resultText = textContent.Text
 		}
 	}
 
-	// 如果没有匹配到任何已知格式，返回错误
-	return 0, nil, nil, errors.New("unknown message format")
+	// 获取并叠加历史信息，传入当前字数
+	pendingMsgsToReturn, _, err := wsclient.GetPendingMessages(echoKey, true, len(resultText))
+	if err != nil {
+		log.Printf("Error getting pending messages: %v", err)
+		// 如果无法获取历史消息，就直接处理当前的消息
+		pendingMsgsToReturn = nil
+	}
+
+	// 遍历所有历史消息，并叠加到 result 前
+	for _, message := range pendingMsgsToReturn {
+		var historyContent string
+		// 处理历史消息内容
+		if msgStr, ok := message.Params.Message.(string); ok {
+			historyContent = msgStr
+		} else {
+			// 如果不是string类型，调用parseMessage函数处理
+			historyContent = praser.ParseMessageContent(message.Params.Message, true)
+		}
+
+		// 将历史信息叠加到当前的 result 前
+		resultText = fmt.Sprintf("%s\n-----历史信息----\n%s", historyContent, resultText)
+	}
+	return []mcp.Content{mcp.NewTextContent(resultText)}
 }
 
-// processInput 处理含有Base64编码的图片和语音信息的字符串
-func processInput(input string) (string, error) {
+// describeRequestAction 描述应用端对加好友/加群请求的处理
+func describeRequestAction(message *callapi.ActionMessage) (string, bool) {
+	var kind string
+	switch message.Action {
+	case "set_friend_add_request":
+		kind = "好友请求"
+	case "set_group_add_request":
+		kind = "加群请求"
+	default:
+		return "", false
+	}
 
-	return input, nil
+	params := message.Params
+	// approve 缺省为同意
+	if params.Approve != nil && !*params.Approve {
+		if params.Reason != "" {
+			return fmt.Sprintf("[拒绝%s] 理由:%s", kind, params.Reason), true
+		}
+		return fmt.Sprintf("[拒绝%s]", kind), true
+	}
+	if params.Remark != "" {
+		return fmt.Sprintf("[同意%s] 备注:%s", kind, params.Remark), true
+	}
+	return fmt.Sprintf("[同意%s]", kind), true
 }
 
-// 转为json并打印
+// 转为json并打印,stdio模式下stdout用于json-rpc,只能写入日志
 func PrintCallToolRequestAsJSON(req mcp.CallToolRequest) error {
 	data, err := json.MarshalIndent(req, "", "  ")
 	if err != nil {
 		return err
 	}
-	fmt.Println(string(data))
+	log.Println(string(data))
 	return nil
 }
 
@@ -558,20 +1026,9 @@ func NewToolResultTwoTexts(text1, text2 string) *mcp.CallToolResult {
 
 // ImageURLToBase64 downloads an image from a URL and returns its base64 encoding as a string
 func ImageURLToBase64(url string) (string, error) {
-	// 1. 发起 GET 请求
-	resp, err := http.Get(url)
+	imgData, err := reply.LoadMedia(url)
 	if err != nil {
 		return "", err
 	}
-	defer resp.Body.Close()
-
-	// 2. 读取所有内容到内存
-	imgData, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
-	}
-
-	// 3. base64 编码
-	base64Str := base64.StdEncoding.EncodeToString(imgData)
-	return base64Str, nil
+	return base64.StdEncoding.EncodeToString(imgData), nil
 }
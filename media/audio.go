@@ -0,0 +1,196 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// AudioInfo 语音的格式与时长,无法解析时长时 Duration 为0
+type AudioInfo struct {
+	MIMEType string
+	Format   string
+	Duration time.Duration
+	Size     int
+}
+
+// Describe 生成语音的文本描述,用于客户端不支持音频内容时
+func (a AudioInfo) Describe() string {
+	desc := fmt.Sprintf("[语音] 格式:%s", a.Format)
+	if a.Duration > 0 {
+		desc += fmt.Sprintf(" 时长:%.1f秒", a.Duration.Seconds())
+	}
+	desc += fmt.Sprintf(" 大小:%.1fKB", float64(a.Size)/1024)
+	return desc
+}
+
+// ProbeAudio 解析语音数据的格式与时长
+func ProbeAudio(data []byte) AudioInfo {
+	info := AudioInfo{
+		MIMEType: SniffMIME(data),
+		Size:     len(data),
+	}
+
+	switch info.MIMEType {
+	case "audio/wav":
+		info.Format = "wav"
+		info.Duration = wavDuration(data)
+	case "audio/silk":
+		info.Format = "silk"
+		info.Duration = silkDuration(data)
+	case "audio/amr":
+		info.Format = "amr"
+		info.Duration = amrDuration(data, amrNBMagic, amrNBFrameSizes)
+	case "audio/amr-wb":
+		info.Format = "amr-wb"
+		info.Duration = amrDuration(data, amrWBMagic, amrWBFrameSizes)
+	case "audio/mpeg":
+		info.Format = "mp3"
+		info.Duration = mp3Duration(data)
+	case "audio/ogg":
+		info.Format = "ogg"
+		info.Duration = oggDuration(data)
+	case "audio/flac":
+		info.Format = "flac"
+		info.Duration = flacDuration(data)
+	case "audio/mp4":
+		info.Format = "m4a"
+	default:
+		info.Format = info.MIMEType
+	}
+
+	return info
+}
+
+// wavDuration 根据 fmt 块的 byte rate 与 data 块大小计算时长
+func wavDuration(data []byte) time.Duration {
+	var byteRate, dataSize uint32
+	for offset := 12; offset+8 <= len(data); {
+		chunkID := string(data[offset : offset+4])
+		chunkSize := binary.LittleEndian.Uint32(data[offset+4 : offset+8])
+		body := offset + 8
+		switch chunkID {
+		case "fmt ":
+			if body+12 <= len(data) {
+				byteRate = binary.LittleEndian.Uint32(data[body+8 : body+12])
+			}
+		case "data":
+			dataSize = chunkSize
+			// data 块可能被截断或标记为流式长度
+			if int(dataSize) > len(data)-body {
+				dataSize = uint32(len(data) - body)
+			}
+		}
+		if byteRate > 0 && dataSize > 0 {
+			break
+		}
+		// 块按偶数字节对齐
+		offset = body + int(chunkSize) + int(chunkSize%2)
+	}
+	if byteRate == 0 {
+		return 0
+	}
+	return time.Duration(float64(dataSize) / float64(byteRate) * float64(time.Second))
+}
+
+// silkDuration silk 每帧20ms,帧前有2字节小端长度
+func silkDuration(data []byte) time.Duration {
+	offset := bytes.Index(data, []byte("#!SILK_V3")) + len("#!SILK_V3")
+	frames := 0
+	for offset+2 <= len(data) {
+		size := int(binary.LittleEndian.Uint16(data[offset : offset+2]))
+		// 0xFFFF 为结束标记
+		if size == 0xFFFF || offset+2+size > len(data) {
+			break
+		}
+		offset += 2 + size
+		frames++
+	}
+	return time.Duration(frames) * 20 * time.Millisecond
+}
+
+// AMR 文件头,多声道的 AMR 不解析时长
+const (
+	amrNBMagic = "#!AMR\n"
+	amrWBMagic = "#!AMR-WB\n"
+)
+
+// amrNBFrameSizes AMR-NB 各模式的帧长度(不含帧头)
+var amrNBFrameSizes = [16]int{12, 13, 15, 17, 19, 20, 26, 31, 5, 0, 0, 0, 0, 0, 0, 0}
+
+// amrWBFrameSizes AMR-WB 各模式的帧长度(不含帧头)
+var amrWBFrameSizes = [16]int{17, 23, 32, 36, 40, 46, 50, 58, 60, 5, 0, 0, 0, 0, 0, 0}
+
+// amrDuration AMR-NB 与 AMR-WB 每帧都是20ms,文件头不符时返回0
+func amrDuration(data []byte, magic string, frameSizes [16]int) time.Duration {
+	if !bytes.HasPrefix(data, []byte(magic)) {
+		return 0
+	}
+	offset := len(magic)
+	frames := 0
+	for offset < len(data) {
+		mode := (data[offset] >> 3) & 0x0F
+		offset += 1 + frameSizes[mode]
+		frames++
+	}
+	return time.Duration(frames) * 20 * time.Millisecond
+}
+
+// mp3Bitrates MPEG-1 Layer III 的码率表 kbps
+var mp3Bitrates = [16]int{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0}
+
+// mp3Duration 按首帧码率估算时长(假定为CBR)
+func mp3Duration(data []byte) time.Duration {
+	offset := 0
+	// 跳过 ID3v2 标签
+	if len(data) >= 10 && bytes.HasPrefix(data, []byte("ID3")) {
+		size := int(data[6]&0x7F)<<21 | int(data[7]&0x7F)<<14 | int(data[8]&0x7F)<<7 | int(data[9]&0x7F)
+		offset = 10 + size
+	}
+	for ; offset+4 <= len(data); offset++ {
+		// 帧同步字
+		if data[offset] != 0xFF || data[offset+1]&0xE0 != 0xE0 {
+			continue
+		}
+		bitrate := mp3Bitrates[data[offset+2]>>4]
+		if bitrate == 0 {
+			continue
+		}
+		audioBytes := len(data) - offset
+		return time.Duration(float64(audioBytes*8) / float64(bitrate*1000) * float64(time.Second))
+	}
+	return 0
+}
+
+// oggDuration 取最后一页的 granule position 除以采样率
+func oggDuration(data []byte) time.Duration {
+	sampleRate := 0
+	if i := bytes.Index(data, []byte("OpusHead")); i >= 0 {
+		// opus 的 granule 固定以48kHz计
+		sampleRate = 48000
+	} else if i := bytes.Index(data, []byte("\x01vorbis")); i >= 0 && i+16 <= len(data) {
+		sampleRate = int(binary.LittleEndian.Uint32(data[i+12 : i+16]))
+	}
+	last := bytes.LastIndex(data, []byte("OggS"))
+	if sampleRate == 0 || last < 0 || last+14 > len(data) {
+		return 0
+	}
+	granule := binary.LittleEndian.Uint64(data[last+6 : last+14])
+	return time.Duration(float64(granule) / float64(sampleRate) * float64(time.Second))
+}
+
+// flacDuration 根据 STREAMINFO 中的采样率与总采样数计算时长
+func flacDuration(data []byte) time.Duration {
+	// fLaC + 4字节块头 + STREAMINFO
+	if len(data) < 4+4+18 {
+		return 0
+	}
+	info := data[8:]
+	sampleRate := int(info[10])<<12 | int(info[11])<<4 | int(info[12])>>4
+	totalSamples := uint64(info[13]&0x0F)<<32 | uint64(binary.BigEndian.Uint32(info[14:18]))
+	if sampleRate == 0 {
+		return 0
+	}
+	return time.Duration(float64(totalSamples) / float64(sampleRate) * float64(time.Second))
+}
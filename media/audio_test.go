@@ -0,0 +1,44 @@
+package media
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// amrFile 由 frames 个同一模式的帧组成的amr文件
+func amrFile(magic string, mode byte, frameSize, frames int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(magic)
+	for i := 0; i < frames; i++ {
+		buf.WriteByte(mode<<3 | 0x04)
+		buf.Write(make([]byte, frameSize))
+	}
+	return buf.Bytes()
+}
+
+// TestProbeAMR AMR-NB 与 AMR-WB 按各自的帧长度表计算时长
+func TestProbeAMR(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       []byte
+		wantMIME   string
+		wantFormat string
+	}{
+		{"nb 12.2k", amrFile(amrNBMagic, 7, 31, 50), "audio/amr", "amr"},
+		{"wb 23.85k", amrFile(amrWBMagic, 8, 60, 50), "audio/amr-wb", "amr-wb"},
+		{"wb 12.65k", amrFile(amrWBMagic, 2, 32, 50), "audio/amr-wb", "amr-wb"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := ProbeAudio(tt.data)
+			if info.MIMEType != tt.wantMIME || info.Format != tt.wantFormat {
+				t.Errorf("mime %s format %s, want %s %s", info.MIMEType, info.Format, tt.wantMIME, tt.wantFormat)
+			}
+			if info.Duration != time.Second {
+				t.Errorf("duration %v, want 1s", info.Duration)
+			}
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package media
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheURIPrefix 缓存媒体作为 MCP 资源发布时的 uri 前缀
+const CacheURIPrefix = "onebot-media://sha256/"
+
+// ErrNotCached 缓存中没有该媒体
+var ErrNotCached = errors.New("media not cached")
+
+// CacheEntry 缓存中的一个媒体文件
+type CacheEntry struct {
+	Hash     string
+	Size     int64
+	MIMEType string
+}
+
+// URI 返回该媒体的资源 uri
+func (e CacheEntry) URI() string {
+	return CacheURI(e.Hash)
+}
+
+// CacheURI 返回 sha256 对应的资源 uri
+func CacheURI(hash string) string {
+	return CacheURIPrefix + hash
+}
+
+// HashFromURI 从资源 uri 中取出 sha256,uri 不合法时返回 false
+func HashFromURI(uri string) (string, bool) {
+	hash, ok := strings.CutPrefix(uri, CacheURIPrefix)
+	if !ok || !validHash(hash) {
+		return "", false
+	}
+	return hash, true
+}
+
+// Cache 以 sha256 为键的本地媒体缓存,总体积超过配额时按最近最少使用淘汰
+type Cache struct {
+	dir   string
+	quota int64
+
+	mu      sync.Mutex
+	entries map[string]*list.Element // hash -> lru 中的元素
+	lru     *list.List               // 队首为最近使用
+	size    int64
+
+	// OnAdd 新媒体写入缓存后调用
+	OnAdd func(entry CacheEntry)
+	// OnEvict 媒体被淘汰后调用
+	OnEvict func(entry CacheEntry)
+}
+
+// NewCache 打开 dir 下的缓存,已有文件按修改时间恢复使用顺序
+func NewCache(dir string, quota int64) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	c := &Cache{
+		dir:     dir,
+		quota:   quota,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	type existing struct {
+		entry   CacheEntry
+		modTime time.Time
+	}
+	var found []existing
+	for _, file := range files {
+		if file.IsDir() || !validHash(file.Name()) {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		found = append(found, existing{
+			entry: CacheEntry{
+				Hash:     file.Name(),
+				Size:     info.Size(),
+				MIMEType: c.sniffFile(file.Name()),
+			},
+			modTime: info.ModTime(),
+		})
+	}
+	// 最近使用的排在前面
+	sort.Slice(found, func(i, j int) bool { return found[i].modTime.After(found[j].modTime) })
+	for _, f := range found {
+		entry := f.entry
+		c.entries[entry.Hash] = c.lru.PushBack(&entry)
+		c.size += entry.Size
+	}
+	// 配额可能被调小
+	for _, entry := range c.evictLocked() {
+		_ = os.Remove(c.path(entry.Hash))
+	}
+
+	return c, nil
+}
+
+// Entries 按最近使用顺序返回所有缓存媒体
+func (c *Cache) Entries() []CacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries := make([]CacheEntry, 0, c.lru.Len())
+	for e := c.lru.Front(); e != nil; e = e.Next() {
+		entries = append(entries, *e.Value.(*CacheEntry))
+	}
+	return entries
+}
+
+// Put 写入媒体并返回其缓存条目,已存在时只更新使用顺序
+func (c *Cache) Put(data []byte) (CacheEntry, error) {
+	sum := sha256.Sum256(data)
+	entry := CacheEntry{
+		Hash:     hex.EncodeToString(sum[:]),
+		Size:     int64(len(data)),
+		MIMEType: SniffMIME(data),
+	}
+	if entry.Size > c.quota {
+		return entry, fmt.Errorf("%w: %d bytes exceeds cache quota", ErrTooLarge, entry.Size)
+	}
+
+	c.mu.Lock()
+	if e, ok := c.entries[entry.Hash]; ok {
+		c.touchLocked(e)
+		c.mu.Unlock()
+		return entry, nil
+	}
+
+	// 先写临时文件再重命名,避免读到写了一半的文件
+	tmp, err := os.CreateTemp(c.dir, "tmp-*")
+	if err != nil {
+		c.mu.Unlock()
+		return entry, err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.path(entry.Hash))
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		c.mu.Unlock()
+		return entry, err
+	}
+
+	stored := entry
+	c.entries[entry.Hash] = c.lru.PushFront(&stored)
+	c.size += entry.Size
+	evicted := c.evictLocked()
+	for _, old := range evicted {
+		_ = os.Remove(c.path(old.Hash))
+	}
+	c.mu.Unlock()
+
+	// 回调在锁外执行,回调中可以再次访问缓存
+	if c.OnAdd != nil {
+		c.OnAdd(entry)
+	}
+	if c.OnEvict != nil {
+		for _, old := range evicted {
+			c.OnEvict(old)
+		}
+	}
+	return entry, nil
+}
+
+// Get 读取缓存的媒体
+func (c *Cache) Get(hash string) ([]byte, CacheEntry, error) {
+	if !validHash(hash) {
+		return nil, CacheEntry{}, ErrNotCached
+	}
+
+	c.mu.Lock()
+	e, ok := c.entries[hash]
+	if !ok {
+		c.mu.Unlock()
+		return nil, CacheEntry{}, ErrNotCached
+	}
+	entry := *e.Value.(*CacheEntry)
+	c.touchLocked(e)
+	c.mu.Unlock()
+
+	data, err := os.ReadFile(c.path(hash))
+	if err != nil {
+		// 文件被外部删除
+		c.remove(hash)
+		return nil, entry, ErrNotCached
+	}
+	return data, entry, nil
+}
+
+func (c *Cache) path(hash string) string {
+	return filepath.Join(c.dir, hash)
+}
+
+// touchLocked 标记为最近使用,并同步文件修改时间以便重启后恢复顺序
+func (c *Cache) touchLocked(e *list.Element) {
+	c.lru.MoveToFront(e)
+	now := time.Now()
+	_ = os.Chtimes(c.path(e.Value.(*CacheEntry).Hash), now, now)
+}
+
+// evictLocked 从队尾淘汰直到不超过配额,返回被淘汰的条目
+func (c *Cache) evictLocked() []CacheEntry {
+	var evicted []CacheEntry
+	for c.size > c.quota && c.lru.Len() > 0 {
+		e := c.lru.Back()
+		entry := *e.Value.(*CacheEntry)
+		c.lru.Remove(e)
+		delete(c.entries, entry.Hash)
+		c.size -= entry.Size
+		evicted = append(evicted, entry)
+	}
+	return evicted
+}
+
+// remove 移除文件已丢失的条目
+func (c *Cache) remove(hash string) {
+	c.mu.Lock()
+	e, ok := c.entries[hash]
+	if !ok {
+		c.mu.Unlock()
+		return
+	}
+	entry := *e.Value.(*CacheEntry)
+	c.lru.Remove(e)
+	delete(c.entries, hash)
+	c.size -= entry.Size
+	c.mu.Unlock()
+
+	if c.OnEvict != nil {
+		c.OnEvict(entry)
+	}
+}
+
+// sniffFile 读取文件头判断已有缓存文件的类型
+func (c *Cache) sniffFile(hash string) string {
+	f, err := os.Open(c.path(hash))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+	return SniffMIME(head[:n])
+}
+
+// validHash 判断是否为64位小写十六进制的 sha256
+func validHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	for _, r := range hash {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'f') {
+			return false
+		}
+	}
+	return true
+}
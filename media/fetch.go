@@ -0,0 +1,152 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var (
+	// ErrTooLarge 媒体超过允许的最大体积
+	ErrTooLarge = errors.New("media exceeds size limit")
+	// ErrBlockedAddress 媒体地址指向内网或回环地址
+	ErrBlockedAddress = errors.New("media address is private or loopback")
+)
+
+// Fetcher 下载 http(s) 媒体,限制超时、体积与重定向次数
+type Fetcher struct {
+	Timeout      time.Duration
+	MaxBytes     int64
+	MaxRedirects int
+	// BlockPrivate 禁止访问内网/回环/链路本地地址,在建立连接时按解析后的ip判断
+	BlockPrivate bool
+}
+
+// Fetch 下载 rawURL 的内容,错误信息可直接展示给用户
+func (f *Fetcher) Fetch(rawURL string) ([]byte, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), f.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := f.client().Do(req)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, fmt.Errorf("timeout after %s", f.Timeout)
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("http status %s", resp.Status)
+	}
+	if resp.ContentLength > f.MaxBytes {
+		return nil, fmt.Errorf("%w: %d > %d bytes", ErrTooLarge, resp.ContentLength, f.MaxBytes)
+	}
+
+	// 多读一个字节用于判断是否超限
+	data, err := io.ReadAll(io.LimitReader(resp.Body, f.MaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > f.MaxBytes {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrTooLarge, f.MaxBytes)
+	}
+	return data, nil
+}
+
+// idleConnTimeout 空闲连接的保留时间
+const idleConnTimeout = 90 * time.Second
+
+// transportKey 决定 http.Transport 行为的配置
+type transportKey struct {
+	timeout      time.Duration
+	blockPrivate bool
+}
+
+var (
+	transportMu sync.Mutex
+	// sharedKey 与 sharedTransport 所有下载共用的连接池,配置变化时重建
+	sharedKey       transportKey
+	sharedTransport *http.Transport
+)
+
+// transport 返回与当前配置一致的共用 http.Transport,配置热重载后重建并关闭旧的空闲连接
+func (f *Fetcher) transport() *http.Transport {
+	key := transportKey{timeout: f.Timeout, blockPrivate: f.BlockPrivate}
+
+	transportMu.Lock()
+	defer transportMu.Unlock()
+	if sharedTransport != nil && sharedKey == key {
+		return sharedTransport
+	}
+	if sharedTransport != nil {
+		sharedTransport.CloseIdleConnections()
+	}
+
+	dialer := &net.Dialer{Timeout: f.Timeout}
+	if f.BlockPrivate {
+		dialer.Control = guardPrivate
+	}
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: f.Timeout,
+		IdleConnTimeout:     idleConnTimeout,
+	}
+	// 开启代理时连接的是代理地址,无法判断目标地址
+	if f.BlockPrivate {
+		transport.Proxy = nil
+	}
+
+	sharedKey, sharedTransport = key, transport
+	return transport
+}
+
+// client 下载使用的 http.Client,重定向次数每次按 MaxRedirects 判断
+func (f *Fetcher) client() *http.Client {
+	return &http.Client{
+		Transport: f.transport(),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > f.MaxRedirects {
+				return fmt.Errorf("stopped after %d redirects", f.MaxRedirects)
+			}
+			return nil
+		},
+	}
+}
+
+// guardPrivate 在连接建立前检查解析后的地址,同时防止dns重绑定
+func guardPrivate(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, host)
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, ip)
+	}
+	return nil
+}
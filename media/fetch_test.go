@@ -0,0 +1,109 @@
+package media
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newMediaServer 测试用的媒体服务器
+//
+//	/small     100字节
+//	/large     2000字节,带 Content-Length
+//	/stream    2000字节,分块传输没有 Content-Length
+//	/redirect/n 重定向n次后到 /small
+//	/slow      超过超时时间才响应
+func newMediaServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/small", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, 100))
+	})
+	mux.HandleFunc("/large", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "2000")
+		w.Write(make([]byte, 2000))
+	})
+	mux.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 20; i++ {
+			w.Write(make([]byte, 100))
+			w.(http.Flusher).Flush()
+		}
+	})
+	mux.HandleFunc("/redirect/", func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/redirect/"))
+		if n <= 1 {
+			http.Redirect(w, r, "/small", http.StatusFound)
+			return
+		}
+		http.Redirect(w, r, "/redirect/"+strconv.Itoa(n-1), http.StatusFound)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestFetchGuards 体积、重定向、超时与内网地址的限制
+func TestFetchGuards(t *testing.T) {
+	server := newMediaServer(t)
+	fetcher := &Fetcher{Timeout: 200 * time.Millisecond, MaxBytes: 1000, MaxRedirects: 2}
+
+	tests := []struct {
+		name    string
+		fetcher *Fetcher
+		url     string
+		wantLen int
+		wantErr string
+		wantIs  error
+	}{
+		{name: "within limits", url: server.URL + "/small", wantLen: 100},
+		{name: "content length over limit", url: server.URL + "/large", wantIs: ErrTooLarge},
+		{name: "stream over limit", url: server.URL + "/stream", wantIs: ErrTooLarge},
+		{name: "redirects within limit", url: server.URL + "/redirect/2", wantLen: 100},
+		{name: "too many redirects", url: server.URL + "/redirect/3", wantErr: "stopped after 2 redirects"},
+		{name: "timeout", url: server.URL + "/slow", wantErr: "timeout after 200ms"},
+		{name: "unsupported scheme", url: "file:///etc/passwd", wantErr: `unsupported scheme "file"`},
+		{
+			name:    "loopback blocked",
+			fetcher: &Fetcher{Timeout: time.Second, MaxBytes: 1000, BlockPrivate: true},
+			url:     server.URL + "/small",
+			wantIs:  ErrBlockedAddress,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := fetcher
+			if tt.fetcher != nil {
+				f = tt.fetcher
+			}
+			data, err := f.Fetch(tt.url)
+			switch {
+			case tt.wantIs != nil:
+				if !errors.Is(err, tt.wantIs) {
+					t.Fatalf("err = %v, want %v", err, tt.wantIs)
+				}
+			case tt.wantErr != "":
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+			default:
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(data) != tt.wantLen {
+					t.Errorf("got %d bytes, want %d", len(data), tt.wantLen)
+				}
+			}
+		})
+	}
+}
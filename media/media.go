@@ -0,0 +1,83 @@
+// Package media 处理bot回复中的图片/语音等媒体数据
+package media
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Base64Prefix CQ码中base64媒体的前缀
+const Base64Prefix = "base64://"
+
+// IsBase64 判断媒体来源是否为 base64:// 形式
+func IsBase64(src string) bool {
+	return strings.HasPrefix(src, Base64Prefix)
+}
+
+// DecodeBase64 解码 base64:// 形式的媒体,兼容无填充与url安全编码
+func DecodeBase64(src string) ([]byte, error) {
+	encoded := strings.TrimPrefix(src, Base64Prefix)
+	// 去掉可能存在的换行与空白
+	encoded = strings.Join(strings.Fields(encoded), "")
+	if encoded == "" {
+		return nil, errors.New("empty base64 media")
+	}
+
+	encodings := []*base64.Encoding{
+		base64.StdEncoding,
+		base64.RawStdEncoding,
+		base64.URLEncoding,
+		base64.RawURLEncoding,
+	}
+	var lastErr error
+	for _, encoding := range encodings {
+		data, err := encoding.DecodeString(encoded)
+		if err == nil {
+			return data, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// SniffMIME 根据文件头判断媒体的MIME类型
+func SniffMIME(data []byte) string {
+	switch {
+	// QQ语音常用的silk与amr,http.DetectContentType 无法识别
+	case bytes.HasPrefix(data, []byte("#!SILK_V3")), bytes.HasPrefix(data, []byte("\x02#!SILK_V3")):
+		return "audio/silk"
+	case bytes.HasPrefix(data, []byte(amrWBMagic)):
+		return "audio/amr-wb"
+	case bytes.HasPrefix(data, []byte("#!AMR")):
+		return "audio/amr"
+	case len(data) >= 12 && bytes.Equal(data[4:8], []byte("ftyp")):
+		// mp4 容器,m4a 为音频
+		if bytes.HasPrefix(data[8:], []byte("M4A")) {
+			return "audio/mp4"
+		}
+		return "video/mp4"
+	case bytes.HasPrefix(data, []byte("fLaC")):
+		return "audio/flac"
+	}
+
+	mimeType := http.DetectContentType(data)
+	// 去掉 charset 等参数
+	if i := strings.Index(mimeType, ";"); i >= 0 {
+		mimeType = mimeType[:i]
+	}
+	switch mimeType {
+	case "audio/wave":
+		return "audio/wav"
+	case "application/ogg":
+		return "audio/ogg"
+	case "application/octet-stream":
+		// 不带 ID3 标签的 mp3 以帧同步字开头
+		if len(data) >= 2 && data[0] == 0xFF && data[1]&0xE0 == 0xE0 {
+			return "audio/mpeg"
+		}
+	}
+	return mimeType
+}
@@ -0,0 +1,187 @@
+// 成员目录 由模拟数据与上报事件的发送者组成
+package members
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo-mcp/fixtures"
+)
+
+var (
+	mu sync.RWMutex
+	// observed 上报事件中出现过的群成员 group_id -> user_id -> 成员
+	observed = make(map[string]map[string]*fixtures.Member)
+	// users 私聊与群聊中出现过的用户
+	users = make(map[string]*fixtures.Member)
+)
+
+// Observe 登记上报事件的发送者 groupID 为空时为私聊
+func Observe(groupID, userID string, sender map[string]interface{}) {
+	if userID == "" || userID == "0" {
+		return
+	}
+	now := time.Now().Unix()
+
+	mu.Lock()
+	defer mu.Unlock()
+	user, ok := users[userID]
+	if !ok {
+		user = &fixtures.Member{UserID: userID}
+		users[userID] = user
+	}
+	applySender(user, sender)
+	user.LastSentTime = now
+
+	if groupID == "" || groupID == "0" {
+		return
+	}
+	group, ok := observed[groupID]
+	if !ok {
+		group = make(map[string]*fixtures.Member)
+		observed[groupID] = group
+	}
+	member, ok := group[userID]
+	if !ok {
+		member = &fixtures.Member{UserID: userID, Role: "member", JoinTime: now}
+		group[userID] = member
+	}
+	applySender(member, sender)
+	member.LastSentTime = now
+}
+
+// Group 查找群,模拟数据中没有的群在有成员发言后以群号为群名
+func Group(groupID string) (fixtures.Group, bool) {
+	if group, ok := fixtureGroup(groupID); ok {
+		return group, true
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+	group, ok := observed[groupID]
+	if !ok {
+		return fixtures.Group{}, false
+	}
+	return fixtures.Group{
+		GroupID:        groupID,
+		GroupName:      groupID,
+		MemberCount:    len(group),
+		MaxMemberCount: 500,
+	}, true
+}
+
+// Member 查找群成员,模拟数据中的资料优先,发言时间取上报事件
+func Member(groupID, userID string) (fixtures.Member, bool) {
+	member, found := fixtureMember(groupID, userID)
+
+	mu.RLock()
+	defer mu.RUnlock()
+	seen, ok := observed[groupID][userID]
+	if !ok {
+		return member, found
+	}
+	if !found {
+		return *seen, true
+	}
+	return merge(member, *seen), true
+}
+
+// Members 群成员列表,先列出模拟数据中的成员,再按入群时间列出其余发言过的成员
+func Members(groupID string) []fixtures.Member {
+	var list []fixtures.Member
+	listed := make(map[string]bool)
+	if group, ok := fixtureGroup(groupID); ok {
+		for _, member := range group.Members {
+			if merged, ok := Member(groupID, member.UserID); ok {
+				member = merged
+			}
+			list = append(list, member)
+			listed[member.UserID] = true
+		}
+	}
+
+	mu.RLock()
+	var rest []fixtures.Member
+	for userID, member := range observed[groupID] {
+		if !listed[userID] {
+			rest = append(rest, *member)
+		}
+	}
+	mu.RUnlock()
+	sort.Slice(rest, func(i, j int) bool {
+		if rest[i].JoinTime != rest[j].JoinTime {
+			return rest[i].JoinTime < rest[j].JoinTime
+		}
+		return rest[i].UserID < rest[j].UserID
+	})
+	return append(list, rest...)
+}
+
+// Stranger 查找用户资料,依次查找好友、群成员与发言过的用户
+func Stranger(userID string) (fixtures.Member, bool) {
+	f := fixtures.Get()
+	for _, friend := range f.Friends {
+		if friend.UserID == userID {
+			return fixtures.Member{UserID: userID, Nickname: friend.Nickname}, true
+		}
+	}
+	for _, group := range f.Groups {
+		for _, member := range group.Members {
+			if member.UserID == userID {
+				return member, true
+			}
+		}
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+	if user, ok := users[userID]; ok {
+		return *user, true
+	}
+	return fixtures.Member{}, false
+}
+
+func fixtureGroup(groupID string) (fixtures.Group, bool) {
+	for _, group := range fixtures.Get().Groups {
+		if group.GroupID == groupID {
+			return group, true
+		}
+	}
+	return fixtures.Group{}, false
+}
+
+func fixtureMember(groupID, userID string) (fixtures.Member, bool) {
+	group, ok := fixtureGroup(groupID)
+	if !ok {
+		return fixtures.Member{}, false
+	}
+	for _, member := range group.Members {
+		if member.UserID == userID {
+			return member, true
+		}
+	}
+	return fixtures.Member{}, false
+}
+
+// merge 以模拟数据为准,补充上报事件中的昵称与发言时间
+func merge(member, seen fixtures.Member) fixtures.Member {
+	if member.Nickname == "" {
+		member.Nickname = seen.Nickname
+	}
+	if member.JoinTime == 0 {
+		member.JoinTime = seen.JoinTime
+	}
+	member.LastSentTime = seen.LastSentTime
+	return member
+}
+
+// applySender 取发送者中非空的昵称与群名片
+func applySender(member *fixtures.Member, sender map[string]interface{}) {
+	if nickname, _ := sender["nickname"].(string); nickname != "" {
+		member.Nickname = nickname
+	}
+	if card, _ := sender["card"].(string); card != "" {
+		member.Card = card
+	}
+}
@@ -0,0 +1,235 @@
+package praser
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/hoshinonyaruko/gensokyo-mcp/config"
+	"github.com/hoshinonyaruko/gensokyo-mcp/mylog"
+)
+
+var (
+	// cmdInputPattern 匹配 <qqbot-cmd-input text='...' show='...' /> 指令标签
+	cmdInputPattern = regexp.MustCompile(`<qqbot-cmd-input\s[^>]*/>`)
+	// atUserPattern 匹配 <qqbot-at-user id="..." /> 标签
+	atUserPattern = regexp.MustCompile(`<qqbot-at-user\s[^>]*/>`)
+	// tagAttrPattern 匹配标签属性,单双引号均可
+	tagAttrPattern = regexp.MustCompile(`(\w+)=(?:'([^']*)'|"([^"]*)")`)
+	// mdImagePattern 匹配markdown图片,QQ会在描述中附加 #208px #320px 形式的尺寸
+	mdImagePattern = regexp.MustCompile(`!\[([^\]]*)\]\((https?://[^)\s]+)\)`)
+	// imageSizePattern 匹配图片描述中的尺寸
+	imageSizePattern = regexp.MustCompile(`\s*#\d+px`)
+	// templateParamPattern 匹配模板中的 {{.key}} 参数
+	templateParamPattern = regexp.MustCompile(`\{\{\s*\.?(\w+)\s*\}\}`)
+	// templateIDPattern 模板id只允许字母、数字、下划线与连字符,避免越出模板目录
+	templateIDPattern = regexp.MustCompile(`^[\w-]+$`)
+)
+
+// 按钮的动作类型
+const (
+	ActionLink     = 0
+	ActionCallback = 1
+	ActionCommand  = 2
+)
+
+// actionTypeNames 按钮动作类型的名称
+var actionTypeNames = map[int]string{ActionLink: "跳转", ActionCallback: "回调", ActionCommand: "指令"}
+
+// RenderMarkdown 将 markdown 消息段的数据(可能带有按钮)转换为标准markdown,
+// 模板markdown使用本地模板目录中的模板填充参数,按钮转换为按钮列表
+func RenderMarkdown(mdData []byte) (string, error) {
+	markdown, keyboard, err := parseMDDataPre(mdData)
+	if err != nil {
+		return "", err
+	}
+
+	var parts []string
+	if markdown != nil {
+		if markdown.CustomTemplateID != "" {
+			parts = append(parts, RenderMarkdownContent(renderMarkdownTemplate(markdown)))
+		} else {
+			parts = append(parts, RenderMarkdownContent(markdown.Content))
+		}
+	}
+	if keyboard != nil {
+		if text := RenderKeyboard(keyboard); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, "\n\n"), nil
+}
+
+// RenderMarkdownContent 清理QQ markdown 中的专有标签:
+// 指令标签转换为行内代码,at标签转换为 @id,图片描述去掉尺寸
+func RenderMarkdownContent(content string) string {
+	content = cmdInputPattern.ReplaceAllStringFunc(content, func(tag string) string {
+		attrs := tagAttrs(tag)
+		text := attrs["text"]
+		if text == "" {
+			text = attrs["show"]
+		}
+		return "`" + strings.TrimSpace(text) + "`"
+	})
+	content = atUserPattern.ReplaceAllStringFunc(content, func(tag string) string {
+		return "@" + tagAttrs(tag)["id"]
+	})
+	content = mdImagePattern.ReplaceAllStringFunc(content, func(match string) string {
+		groups := mdImagePattern.FindStringSubmatch(match)
+		alt := strings.TrimSpace(imageSizePattern.ReplaceAllString(groups[1], ""))
+		return fmt.Sprintf("![%s](%s)", alt, groups[2])
+	})
+	return strings.TrimSpace(content)
+}
+
+// MarkdownImageURLs 返回markdown中图片的地址
+func MarkdownImageURLs(content string) []string {
+	var urls []string
+	for _, groups := range mdImagePattern.FindAllStringSubmatch(content, -1) {
+		urls = append(urls, groups[2])
+	}
+	return urls
+}
+
+// ParseKeyboard 解析 keyboard 消息段的数据
+func ParseKeyboard(kbData []byte) (*MessageKeyboard, error) {
+	var temp struct {
+		ID      string          `json:"id,omitempty"`
+		Content *CustomKeyboard `json:"content,omitempty"`
+		Rows    []*Row          `json:"rows,omitempty"`
+	}
+	if err := json.Unmarshal(kbData, &temp); err != nil {
+		return nil, err
+	}
+
+	keyboard := &MessageKeyboard{ID: temp.ID, Content: temp.Content}
+	if keyboard.Content == nil && len(temp.Rows) > 0 {
+		keyboard.Content = &CustomKeyboard{Rows: temp.Rows}
+	}
+	return keyboard, nil
+}
+
+// MarkdownKeyboard 返回 markdown 消息段数据中的按钮,没有按钮时为nil
+func MarkdownKeyboard(mdData []byte) *MessageKeyboard {
+	_, keyboard, err := parseMDDataPre(mdData)
+	if err != nil {
+		return nil
+	}
+	return keyboard
+}
+
+// RenderKeyboard 将按钮转换为按钮列表,每个按钮一行,标明按钮id、动作类型与数据,
+// 只有模板id时返回模板id
+func RenderKeyboard(keyboard *MessageKeyboard) string {
+	if keyboard == nil {
+		return ""
+	}
+	if keyboard.Content == nil {
+		if keyboard.ID != "" {
+			return "按钮模板: `" + keyboard.ID + "`"
+		}
+		return ""
+	}
+
+	var lines []string
+	for _, button := range keyboard.Buttons() {
+		lines = append(lines, fmt.Sprintf("- `%s` %s", ButtonID(button), buttonLine(button)))
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return "**按钮**\n" + strings.Join(lines, "\n")
+}
+
+// Buttons 按顺序返回所有有效的按钮
+func (k *MessageKeyboard) Buttons() []*Button {
+	if k == nil || k.Content == nil {
+		return nil
+	}
+	var buttons []*Button
+	for _, row := range k.Content.Rows {
+		if row == nil {
+			continue
+		}
+		for _, button := range row.Buttons {
+			if button != nil && button.RenderData != nil && button.Action != nil {
+				buttons = append(buttons, button)
+			}
+		}
+	}
+	return buttons
+}
+
+// ButtonID 按钮的稳定id,由动作类型、数据与标签决定,同一按钮在不同回复中id相同
+func ButtonID(button *Button) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d\x00%s\x00%s", button.Action.Type, button.Action.Data, button.RenderData.Label)))
+	return "btn_" + hex.EncodeToString(sum[:4])
+}
+
+// buttonLine 按钮的文本形式,如 签到 (指令: `/签到`)
+func buttonLine(button *Button) string {
+	actionType, ok := actionTypeNames[button.Action.Type]
+	if !ok {
+		actionType = fmt.Sprintf("类型%d", button.Action.Type)
+	}
+	data := "`" + button.Action.Data + "`"
+	if button.Action.Type == ActionLink {
+		data = "<" + button.Action.Data + ">"
+	}
+	return fmt.Sprintf("%s (%s: %s)", button.RenderData.Label, actionType, data)
+}
+
+// renderMarkdownTemplate 使用本地模板填充模板markdown的参数,
+// 找不到模板时列出模板id与参数
+func renderMarkdownTemplate(markdown *Markdown) string {
+	params := make(map[string]string, len(markdown.Params))
+	for _, param := range markdown.Params {
+		if param != nil {
+			params[param.Key] = strings.Join(param.Values, "")
+		}
+	}
+
+	template, ok := loadMarkdownTemplate(markdown.CustomTemplateID)
+	if !ok {
+		lines := []string{"markdown模板: `" + markdown.CustomTemplateID + "`"}
+		for _, param := range markdown.Params {
+			if param != nil {
+				lines = append(lines, fmt.Sprintf("- %s: %s", param.Key, params[param.Key]))
+			}
+		}
+		return strings.Join(lines, "\n")
+	}
+	return templateParamPattern.ReplaceAllStringFunc(template, func(match string) string {
+		return params[templateParamPattern.FindStringSubmatch(match)[1]]
+	})
+}
+
+// loadMarkdownTemplate 读取模板目录中的 <模板id>.md
+func loadMarkdownTemplate(id string) (string, bool) {
+	dir := config.GetMarkdownTemplateDir()
+	if dir == "" || !templateIDPattern.MatchString(id) {
+		return "", false
+	}
+	data, err := os.ReadFile(filepath.Join(dir, id+".md"))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			mylog.Printf("Error reading markdown template %s: %v", id, err)
+		}
+		return "", false
+	}
+	return string(data), true
+}
+
+// tagAttrs 解析标签的属性
+func tagAttrs(tag string) map[string]string {
+	attrs := make(map[string]string)
+	for _, groups := range tagAttrPattern.FindAllStringSubmatch(tag, -1) {
+		attrs[groups[1]] = groups[2] + groups[3]
+	}
+	return attrs
+}
@@ -0,0 +1,110 @@
+package reply
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/hoshinonyaruko/gensokyo-mcp/cq"
+	"github.com/hoshinonyaruko/gensokyo-mcp/media"
+	"github.com/hoshinonyaruko/gensokyo-mcp/mylog"
+	"github.com/hoshinonyaruko/gensokyo-mcp/praser"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// MarkdownURIPrefix 内嵌markdown内容的资源地址前缀
+const MarkdownURIPrefix = "onebot-markdown://"
+
+// 注册内置的消息段渲染器
+func init() {
+	RegisterText(Text, func(_ *Context, segment Segment) string {
+		return segment.Get("text")
+	})
+	// at 对工具结果没有意义,与以往一样去掉
+	RegisterText(At, func(*Context, Segment) string {
+		return ""
+	})
+	// 表情、回复、卡片等转换为文本,并在结果 _meta 中记录结构化数据
+	for _, segmentType := range []SegmentType{
+		Face, MFace, Reply, Forward, JSON, XML, Share, Music,
+		Poke, Dice, RPS, Contact, Location, Video, File, Shake,
+	} {
+		RegisterText(segmentType, renderStructured)
+	}
+
+	Register(Image, RendererFunc(renderImage))
+	Register(Record, RendererFunc(renderRecord))
+	Register(Markdown, RendererFunc(renderMarkdown))
+	Register(Keyboard, RendererFunc(renderKeyboard))
+	Register(Node, RendererFunc(renderNode))
+}
+
+// renderStructured 按 praser.SegmentText 渲染消息段,并记录其结构化数据
+func renderStructured(ctx *Context, segment Segment) string {
+	ctx.segments = append(ctx.segments, segment.Structured())
+	if text, ok := praser.SegmentText(segment.CQ()); ok {
+		return text
+	}
+	return cq.EncodeSegment(segment.CQ())
+}
+
+// renderMarkdown 将 markdown 消息段渲染为 text/markdown 内容,其中的图片随后按图片段渲染
+func renderMarkdown(ctx *Context, segment Segment) []mcp.Content {
+	var text string
+	if segment.Get("data") == "" {
+		// 部分实现直接以 content 传递 markdown 原文
+		text = praser.RenderMarkdownContent(segment.Get("content"))
+	} else {
+		mdData, err := decodeSegmentJSON(segment.Get("data"))
+		if err == nil {
+			text, err = praser.RenderMarkdown(mdData)
+		}
+		if err != nil {
+			mylog.Printf("Error parsing markdown segment: %v", err)
+			return []mcp.Content{mcp.NewTextContent(cq.EncodeSegment(segment.CQ()))}
+		}
+		ctx.recordKeyboard(praser.MarkdownKeyboard(mdData))
+	}
+
+	contents := []mcp.Content{markdownContent(text)}
+	for _, url := range praser.MarkdownImageURLs(text) {
+		contents = append(contents, renderImage(ctx, Segment{Type: Image, Data: map[string]string{"file": url}})...)
+	}
+	return contents
+}
+
+// renderKeyboard 将按钮渲染为 text/markdown 的按钮列表
+func renderKeyboard(ctx *Context, segment Segment) []mcp.Content {
+	keyboard := map[string]interface{}{"id": segment.Get("id")}
+	if content := segment.Get("content"); content != "" {
+		keyboard["content"] = json.RawMessage(content)
+	}
+	kbData, err := json.Marshal(keyboard)
+	if err == nil {
+		var parsed *praser.MessageKeyboard
+		if parsed, err = praser.ParseKeyboard(kbData); err == nil {
+			ctx.recordKeyboard(parsed)
+			return []mcp.Content{markdownContent(praser.RenderKeyboard(parsed))}
+		}
+	}
+	mylog.Printf("Error parsing keyboard segment: %v", err)
+	return []mcp.Content{mcp.NewTextContent(cq.EncodeSegment(segment.CQ()))}
+}
+
+// markdownContent 以内嵌的 text/markdown 资源返回markdown文本
+func markdownContent(text string) mcp.Content {
+	sum := sha256.Sum256([]byte(text))
+	return mcp.NewEmbeddedResource(mcp.TextResourceContents{
+		URI:      MarkdownURIPrefix + hex.EncodeToString(sum[:8]),
+		MIMEType: "text/markdown",
+		Text:     text,
+	})
+}
+
+// decodeSegmentJSON 解码 base64:// 或json参数,部分实现在数组格式中也会实体化json
+func decodeSegmentJSON(value string) ([]byte, error) {
+	if media.IsBase64(value) {
+		return media.DecodeBase64(value)
+	}
+	return []byte(cq.Unescape(value)), nil
+}
@@ -0,0 +1,124 @@
+package reply
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hoshinonyaruko/gensokyo-mcp/cq"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// maxForwardDepth 嵌套合并转发的最大展开层数
+const maxForwardDepth = 5
+
+// ParseForward 将合并转发的节点列表(params.messages)转换为聊天记录形式的消息段,
+// 每个节点以 "发送者(QQ):" 开头,嵌套的合并转发按层级缩进,图片等消息段保持原样
+func ParseForward(messages interface{}) []Segment {
+	return forwardSegments(forwardNodes(messages), 0)
+}
+
+// forwardNodes 取出节点列表,兼容单个节点与json文本
+func forwardNodes(messages interface{}) []map[string]interface{} {
+	if str, ok := messages.(string); ok {
+		if err := json.Unmarshal([]byte(str), &messages); err != nil {
+			return nil
+		}
+	}
+	var nodes []map[string]interface{}
+	switch messages := messages.(type) {
+	case []interface{}:
+		for _, item := range messages {
+			if node, ok := item.(map[string]interface{}); ok {
+				nodes = append(nodes, node)
+			}
+		}
+	case []map[string]interface{}:
+		nodes = messages
+	case map[string]interface{}:
+		nodes = append(nodes, messages)
+	}
+	return nodes
+}
+
+// isForwardNodes 消息内容是否为嵌套的节点列表
+func isForwardNodes(content interface{}) bool {
+	items, ok := content.([]interface{})
+	if !ok || len(items) == 0 {
+		return false
+	}
+	first, _ := items[0].(map[string]interface{})
+	return first["type"] == "node"
+}
+
+func forwardSegments(nodes []map[string]interface{}, depth int) []Segment {
+	indent := strings.Repeat("  ", depth)
+	segments := []Segment{textSegment(fmt.Sprintf("%s[合并转发 共%d条]\n", indent, len(nodes)))}
+	for _, node := range nodes {
+		segments = append(segments, nodeSegments(node, depth)...)
+	}
+	return segments
+}
+
+// nodeSegments 将一个节点转换为 "- 发送者(QQ): 内容" 形式的消息段
+func nodeSegments(node map[string]interface{}, depth int) []Segment {
+	indent := strings.Repeat("  ", depth)
+	// 标准格式为 {"type":"node","data":{...}},部分实现直接把参数放在节点上
+	data, ok := node["data"].(map[string]interface{})
+	if !ok {
+		data = node
+	}
+	content, hasContent := data["content"]
+	if !hasContent {
+		// 引用已有消息的节点
+		return []Segment{textSegment(fmt.Sprintf("%s- [转发消息:%s]\n", indent, cq.Stringify(data["id"])))}
+	}
+
+	sender := firstValue(data, "name", "nickname")
+	if uin := firstValue(data, "uin", "user_id"); uin != "" {
+		sender = fmt.Sprintf("%s(%s)", sender, uin)
+	}
+	if !isForwardNodes(content) {
+		segments := []Segment{textSegment(indent + "- " + sender + ": ")}
+		segments = append(segments, Parse(content)...)
+		return append(segments, textSegment("\n"))
+	}
+
+	segments := []Segment{textSegment(indent + "- " + sender + ":\n")}
+	if depth+1 >= maxForwardDepth {
+		return append(segments, textSegment(indent+"  [合并转发]\n"))
+	}
+	return append(segments, forwardSegments(forwardNodes(content), depth+1)...)
+}
+
+// renderNode 渲染消息中的单个 node 消息段,content 在数组格式中已保存为json文本
+func renderNode(ctx *Context, segment Segment) []mcp.Content {
+	ctx.segments = append(ctx.segments, segment.Structured())
+	if segment.Get("content") == "" {
+		return Render(ctx, []Segment{textSegment(fmt.Sprintf("[转发消息:%s]\n", segment.Get("id")))})
+	}
+
+	data := make(map[string]interface{}, len(segment.Data))
+	for key, value := range segment.Data {
+		data[key] = value
+	}
+	var content interface{}
+	if err := json.Unmarshal([]byte(segment.Get("content")), &content); err == nil {
+		data["content"] = content
+	}
+	return Render(ctx, nodeSegments(map[string]interface{}{"data": data}, 0))
+}
+
+func textSegment(text string) Segment {
+	return Segment{Type: Text, Data: map[string]string{"text": text}}
+}
+
+// firstValue 返回第一个非空的参数
+func firstValue(data map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		if value := cq.Stringify(data[key]); value != "" {
+			return value
+		}
+	}
+	return ""
+}
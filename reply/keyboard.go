@@ -0,0 +1,69 @@
+package reply
+
+import (
+	"sync"
+
+	"github.com/hoshinonyaruko/gensokyo-mcp/praser"
+)
+
+// maxButtons 按钮登记表最多保留的按钮数,超出时淘汰最早登记的按钮
+const maxButtons = 1024
+
+var (
+	buttonsMu    sync.Mutex
+	buttons      = make(map[string]praser.Button)
+	buttonsOrder []string
+)
+
+// LookupButton 按稳定id查找最近回复中出现过的按钮
+func LookupButton(id string) (praser.Button, bool) {
+	buttonsMu.Lock()
+	defer buttonsMu.Unlock()
+	button, ok := buttons[id]
+	return button, ok
+}
+
+// registerButton 登记按钮,返回其稳定id
+func registerButton(button *praser.Button) string {
+	id := praser.ButtonID(button)
+
+	buttonsMu.Lock()
+	defer buttonsMu.Unlock()
+	if _, ok := buttons[id]; !ok {
+		buttonsOrder = append(buttonsOrder, id)
+		if len(buttonsOrder) > maxButtons {
+			delete(buttons, buttonsOrder[0])
+			buttonsOrder = buttonsOrder[1:]
+		}
+	}
+	buttons[id] = *button
+	return id
+}
+
+// recordKeyboard 登记按钮,并以按钮id替换为稳定id后写入结果 _meta 的 keyboards
+func (c *Context) recordKeyboard(keyboard *praser.MessageKeyboard) {
+	if keyboard == nil || keyboard.Content == nil {
+		return
+	}
+	structured := &praser.CustomKeyboard{}
+	for _, row := range keyboard.Content.Rows {
+		if row == nil {
+			continue
+		}
+		structuredRow := &praser.Row{}
+		for _, button := range row.Buttons {
+			if button == nil || button.RenderData == nil || button.Action == nil {
+				continue
+			}
+			copied := *button
+			copied.ID = registerButton(button)
+			structuredRow.Buttons = append(structuredRow.Buttons, &copied)
+		}
+		if len(structuredRow.Buttons) > 0 {
+			structured.Rows = append(structured.Rows, structuredRow)
+		}
+	}
+	if len(structured.Rows) > 0 {
+		c.keyboards = append(c.keyboards, structured)
+	}
+}
@@ -0,0 +1,184 @@
+package reply
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo-mcp/config"
+	"github.com/hoshinonyaruko/gensokyo-mcp/images"
+	"github.com/hoshinonyaruko/gensokyo-mcp/media"
+	"github.com/hoshinonyaruko/gensokyo-mcp/mylog"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// imageBudget 单次工具结果中图片的数量与总字节预算
+type imageBudget struct {
+	maxCount int
+	maxBytes int
+	count    int
+	bytes    int
+	skipped  int
+}
+
+func newImageBudget() *imageBudget {
+	return &imageBudget{
+		maxCount: config.GetImageMaxCount(),
+		maxBytes: config.GetImageMaxTotalKB() * 1024,
+	}
+}
+
+// allow 判断一张大小为 size 字节的图片能否放入结果,能放入时计入预算
+func (b *imageBudget) allow(size int) bool {
+	if b.count >= b.maxCount || b.bytes+size > b.maxBytes {
+		b.skipped++
+		return false
+	}
+	b.count++
+	b.bytes += size
+	return true
+}
+
+// full 图片数量已达上限
+func (b *imageBudget) full() bool {
+	return b.count >= b.maxCount
+}
+
+// note 有图片因超出限制被省略时返回提示文本
+func (b *imageBudget) note() string {
+	if b.skipped == 0 {
+		return ""
+	}
+	return fmt.Sprintf("另有%d张图片超出数量或体积限制,已省略", b.skipped)
+}
+
+// renderImage 加载并压缩图片,超出预算的图片被省略,加载失败的图片以文本提示代替,
+// 同一结果中重复的图片只返回一次
+func renderImage(ctx *Context, segment Segment) []mcp.Content {
+	source := mediaSource(segment)
+	if ctx.seenImages[source] {
+		return nil
+	}
+	ctx.seenImages[source] = true
+
+	// 数量已满时无需再下载
+	if ctx.budget.full() {
+		ctx.budget.skipped++
+		return nil
+	}
+	data, err := LoadMedia(source)
+	if err != nil {
+		// 单张图片加载失败不影响其他内容
+		mylog.Printf("Error loading image %s: %v", describeSource(source), err)
+		return []mcp.Content{mcp.NewTextContent(fmt.Sprintf("[图片] 加载失败 %s: %v", describeSource(source), err))}
+	}
+	originalSize := len(data)
+	if compressed, err := images.CompressSingleImage(data); err != nil {
+		// 无法解码的格式(如webp)或尺寸超过解码上限的图片原样返回
+		mylog.Printf("Error compressing image %s: %v", describeSource(source), err)
+	} else {
+		data = compressed
+	}
+	if !ctx.budget.allow(len(data)) {
+		return nil
+	}
+
+	mimeType := media.SniffMIME(data)
+	uri := ctx.cacheMedia(data)
+	ctx.images = append(ctx.images, map[string]any{
+		"original_bytes":   originalSize,
+		"compressed_bytes": len(data),
+		"mime_type":        mimeType,
+		"uri":              uri,
+	})
+	if ctx.MediaLinks && uri != "" {
+		return []mcp.Content{mcp.NewTextContent("[图片] " + uri)}
+	}
+	return []mcp.Content{mcp.NewImageContent(base64.StdEncoding.EncodeToString(data), mimeType)}
+}
+
+// renderRecord 加载语音并转换为音频内容,客户端不接收音频时返回文本描述
+func renderRecord(ctx *Context, segment Segment) []mcp.Content {
+	source := mediaSource(segment)
+	data, err := LoadMedia(source)
+	if err != nil {
+		mylog.Printf("Error loading record %s: %v", describeSource(source), err)
+		return []mcp.Content{mcp.NewTextContent(fmt.Sprintf("[语音] 加载失败 %s: %v", describeSource(source), err))}
+	}
+
+	info := media.ProbeAudio(data)
+	uri := ctx.cacheMedia(data)
+	ctx.records = append(ctx.records, map[string]any{
+		"bytes":       info.Size,
+		"mime_type":   info.MIMEType,
+		"duration_ms": info.Duration.Milliseconds(),
+		"uri":         uri,
+	})
+	switch {
+	case ctx.MediaLinks && uri != "":
+		return []mcp.Content{mcp.NewTextContent(info.Describe() + " " + uri)}
+	case !ctx.AcceptAudio:
+		return []mcp.Content{mcp.NewTextContent(info.Describe())}
+	default:
+		return []mcp.Content{mcp.NewAudioContent(base64.StdEncoding.EncodeToString(data), info.MIMEType)}
+	}
+}
+
+// mediaSource 返回媒体来源,file 不是 http(s)/base64 时(如本地文件名)使用 url
+func mediaSource(segment Segment) string {
+	file := segment.Get("file")
+	if media.IsBase64(file) || strings.HasPrefix(file, "http://") || strings.HasPrefix(file, "https://") {
+		return file
+	}
+	if url := segment.Get("url"); url != "" {
+		return url
+	}
+	return file
+}
+
+// maxSourceLen 日志与提示文本中媒体来源的最大长度
+const maxSourceLen = 128
+
+// describeSource 日志与提示文本中的媒体来源,base64 只显示大约的字节数,过长的地址被截断
+func describeSource(source string) string {
+	if media.IsBase64(source) {
+		size := len(source) - len(media.Base64Prefix)
+		return fmt.Sprintf("%s(%.1fKB)", media.Base64Prefix, float64(size)*3/4/1024)
+	}
+	if runes := []rune(source); len(runes) > maxSourceLen {
+		return string(runes[:maxSourceLen]) + "..."
+	}
+	return source
+}
+
+// cacheMedia 将返回给客户端的媒体写入缓存,返回资源 uri,未开启缓存时为空
+func (c *Context) cacheMedia(data []byte) string {
+	if c.Cache == nil {
+		return ""
+	}
+	entry, err := c.Cache.Put(data)
+	if err != nil {
+		mylog.Printf("Error caching media: %v", err)
+		return ""
+	}
+	return entry.URI()
+}
+
+// LoadMedia 解码 base64:// 媒体或下载 http(s) 媒体
+func LoadMedia(source string) ([]byte, error) {
+	if media.IsBase64(source) {
+		return media.DecodeBase64(source)
+	}
+	return newMediaFetcher().Fetch(source)
+}
+
+// newMediaFetcher 按当前配置创建媒体下载器
+func newMediaFetcher() *media.Fetcher {
+	return &media.Fetcher{
+		Timeout:      time.Duration(config.GetMediaFetchTimeout()) * time.Second,
+		MaxBytes:     int64(config.GetMediaMaxKB()) * 1024,
+		MaxRedirects: config.GetMediaMaxRedirects(),
+		BlockPrivate: config.GetMediaBlockPrivate(),
+	}
+}
@@ -0,0 +1,156 @@
+package reply
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/hoshinonyaruko/gensokyo-mcp/cq"
+	"github.com/hoshinonyaruko/gensokyo-mcp/media"
+	"github.com/hoshinonyaruko/gensokyo-mcp/praser"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Renderer 将一个消息段转换为工具结果内容
+type Renderer interface {
+	Render(ctx *Context, segment Segment) []mcp.Content
+}
+
+// RendererFunc 以函数实现 Renderer
+type RendererFunc func(ctx *Context, segment Segment) []mcp.Content
+
+func (f RendererFunc) Render(ctx *Context, segment Segment) []mcp.Content {
+	return f(ctx, segment)
+}
+
+// TextRenderer 将一个消息段转换为行内文本,相邻的行内文本合并为一个文本内容
+type TextRenderer func(ctx *Context, segment Segment) string
+
+var (
+	renderersMu   sync.RWMutex
+	renderers     = make(map[SegmentType]Renderer)
+	textRenderers = make(map[SegmentType]TextRenderer)
+)
+
+// Register 注册独立成块的消息段(图片、语音等)的渲染器,会覆盖同类型已有的渲染器
+func Register(segmentType SegmentType, renderer Renderer) {
+	renderersMu.Lock()
+	defer renderersMu.Unlock()
+	delete(textRenderers, segmentType)
+	renderers[segmentType] = renderer
+}
+
+// RegisterText 注册行内消息段(文本、at等)的渲染器,会覆盖同类型已有的渲染器
+func RegisterText(segmentType SegmentType, renderer TextRenderer) {
+	renderersMu.Lock()
+	defer renderersMu.Unlock()
+	delete(renderers, segmentType)
+	textRenderers[segmentType] = renderer
+}
+
+// Context 一次工具结果的渲染状态,在同一结果的多条回复间共享
+type Context struct {
+	// AcceptAudio 客户端能否接收音频内容
+	AcceptAudio bool
+	// MediaLinks 以资源链接代替内联媒体,需要 Cache
+	MediaLinks bool
+	// Cache 媒体缓存,为nil时不缓存
+	Cache *media.Cache
+
+	budget     *imageBudget
+	seenImages map[string]bool
+	// images 每张返回图片的原始与压缩后大小
+	images []map[string]any
+	// records 每条返回语音的格式与时长
+	records []map[string]any
+	// segments 表情、回复、卡片等消息段的结构化数据
+	segments []map[string]any
+	// keyboards 回复中的按钮,按钮id为稳定id,可用于 click_button
+	keyboards []*praser.CustomKeyboard
+}
+
+// NewContext 创建渲染状态,图片数量与体积限制对整个工具结果生效
+func NewContext(acceptAudio, mediaLinks bool, cache *media.Cache) *Context {
+	return &Context{
+		AcceptAudio: acceptAudio,
+		MediaLinks:  mediaLinks && cache != nil,
+		Cache:       cache,
+		budget:      newImageBudget(),
+		seenImages:  make(map[string]bool),
+	}
+}
+
+// Notes 渲染结束后需要附加的提示内容
+func (c *Context) Notes() []mcp.Content {
+	if note := c.budget.note(); note != "" {
+		return []mcp.Content{mcp.NewTextContent(note)}
+	}
+	return nil
+}
+
+// Meta 渲染过程中记录的媒体信息,写入结果 _meta
+func (c *Context) Meta() map[string]any {
+	meta := make(map[string]any)
+	if len(c.images) > 0 {
+		meta["images"] = c.images
+	}
+	if len(c.records) > 0 {
+		meta["records"] = c.records
+	}
+	if len(c.segments) > 0 {
+		meta["segments"] = c.segments
+	}
+	if len(c.keyboards) > 0 {
+		meta["keyboards"] = c.keyboards
+	}
+	return meta
+}
+
+// lookup 查找消息段的渲染器,两者都为nil时按未知消息段处理
+func lookup(segmentType SegmentType) (Renderer, TextRenderer) {
+	renderersMu.RLock()
+	defer renderersMu.RUnlock()
+	return renderers[segmentType], textRenderers[segmentType]
+}
+
+// Render 按顺序渲染消息段,渲染器可以递归调用 Render
+func Render(ctx *Context, segments []Segment) []mcp.Content {
+	var contents []mcp.Content
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			contents = append(contents, mcp.NewTextContent(text.String()))
+			text.Reset()
+		}
+	}
+
+	for _, segment := range segments {
+		renderer, textRenderer := lookup(segment.Type)
+		if renderer != nil {
+			flush()
+			contents = append(contents, renderer.Render(ctx, segment)...)
+			continue
+		}
+		if textRenderer == nil {
+			textRenderer = renderUnknown
+		}
+		text.WriteString(textRenderer(ctx, segment))
+	}
+	flush()
+
+	return contents
+}
+
+// IsPlainText 消息是否只包含行内消息段
+func IsPlainText(segments []Segment) bool {
+	for _, segment := range segments {
+		if renderer, _ := lookup(segment.Type); renderer != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// renderUnknown 未注册的消息段保留为CQ码
+func renderUnknown(_ *Context, segment Segment) string {
+	return cq.EncodeSegment(segment.CQ())
+}
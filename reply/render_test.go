@@ -0,0 +1,230 @@
+package reply
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/hoshinonyaruko/gensokyo-mcp/callapi"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// testPNG 1x1 的png图片,以 base64:// 传入,避免测试访问网络
+func testPNG(t *testing.T) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	return "base64://" + base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+// testWAV 时长1秒的 8kHz 16bit 单声道wav
+func testWAV(t *testing.T) string {
+	t.Helper()
+	const sampleRate, dataSize = 8000, 16000
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+dataSize))
+	buf.WriteString("WAVEfmt ")
+	for _, v := range []interface{}{
+		uint32(16), uint16(1), uint16(1), uint32(sampleRate), uint32(sampleRate * 2), uint16(2), uint16(16),
+	} {
+		binary.Write(&buf, binary.LittleEndian, v)
+	}
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(dataSize))
+	buf.Write(make([]byte, dataSize))
+	return "base64://" + base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+// summarize 将工具结果内容转换为便于比较的文本
+func summarize(t *testing.T, contents []mcp.Content) []string {
+	t.Helper()
+	var out []string
+	for _, content := range contents {
+		switch c := content.(type) {
+		case mcp.TextContent:
+			out = append(out, "text:"+c.Text)
+		case mcp.ImageContent:
+			out = append(out, "image:"+c.MIMEType)
+		case mcp.AudioContent:
+			out = append(out, "audio:"+c.MIMEType)
+		case mcp.EmbeddedResource:
+			resource, ok := c.Resource.(mcp.TextResourceContents)
+			if !ok {
+				t.Fatalf("unexpected resource %#v", c.Resource)
+			}
+			out = append(out, resource.MIMEType+":"+resource.Text)
+		default:
+			t.Fatalf("unexpected content %#v", content)
+		}
+	}
+	return out
+}
+
+// TestRenderRecordedPayloads 以应用端实际发送的 send_group_msg/send_private_msg 验证解析与渲染,
+// 同一消息的CQ码与数组两种格式应得到相同的结果
+func TestRenderRecordedPayloads(t *testing.T) {
+	pngSource := testPNG(t)
+	wavSource := testWAV(t)
+
+	tests := []struct {
+		name        string
+		payload     string
+		acceptAudio bool
+		want        []string
+		// wantSegments 结果 _meta.segments 的json,为空表示没有
+		wantSegments string
+	}{
+		{
+			name:         "string text with face and escapes",
+			payload:      `{"action":"send_group_msg","params":{"group_id":868858989,"message":"你好[CQ:face,id=14]世界&#91;1&#93; &amp; 再见"}}`,
+			want:         []string{"text:你好[表情:微笑]世界[1] & 再见"},
+			wantSegments: `[{"data":{"id":"14"},"type":"face"}]`,
+		},
+		{
+			name:         "array text with face",
+			payload:      `{"action":"send_group_msg","params":{"group_id":868858989,"message":[{"type":"text","data":{"text":"你好"}},{"type":"face","data":{"id":14}},{"type":"text","data":{"text":"世界[1] & 再见"}}]}}`,
+			want:         []string{"text:你好[表情:微笑]世界[1] & 再见"},
+			wantSegments: `[{"data":{"id":"14"},"type":"face"}]`,
+		},
+		{
+			name:    "string image between text",
+			payload: `{"action":"send_group_msg","params":{"group_id":868858989,"message":"看图[CQ:image,file=` + pngSource + `]好看吗"}}`,
+			want:    []string{"text:看图", "image:image/png", "text:好看吗"},
+		},
+		{
+			name:    "array image between text",
+			payload: `{"action":"send_group_msg","params":{"group_id":868858989,"message":[{"type":"text","data":{"text":"看图"}},{"type":"image","data":{"file":"` + pngSource + `"}},{"type":"text","data":{"text":"好看吗"}}]}}`,
+			want:    []string{"text:看图", "image:image/png", "text:好看吗"},
+		},
+		{
+			name:        "string record as audio",
+			payload:     `{"action":"send_private_msg","params":{"user_id":2022717137,"message":"[CQ:record,file=` + wavSource + `]"}}`,
+			acceptAudio: true,
+			want:        []string{"audio:audio/wav"},
+		},
+		{
+			name:    "array record as text",
+			payload: `{"action":"send_private_msg","params":{"user_id":2022717137,"message":[{"type":"record","data":{"file":"` + wavSource + `"}}]}}`,
+			want:    []string{"text:[语音] 格式:wav 时长:1.0秒 大小:15.7KB"},
+		},
+		{
+			name:    "array markdown with keyboard",
+			payload: `{"action":"send_group_msg","params":{"group_id":868858989,"message":[{"type":"markdown","data":{"data":"{\"markdown\":{\"content\":\"# 标题\\n<qqbot-cmd-input text='/签到' show='签到' />\"},\"keyboard\":{\"content\":{\"rows\":[{\"buttons\":[{\"render_data\":{\"label\":\"签到\"},\"action\":{\"type\":2,\"data\":\"/签到\"}}]}]}}}"}}]}}`,
+			want:    []string{"text/markdown:# 标题\n`/签到`\n\n**按钮**\n- `btn_1f94dbd9` 签到 (指令: `/签到`)"},
+		},
+		{
+			name:    "string markdown in base64",
+			payload: `{"action":"send_group_msg","params":{"group_id":868858989,"message":"[CQ:markdown,data=base64://` + base64.StdEncoding.EncodeToString([]byte(`{"markdown":{"content":"**加粗**"}}`)) + `]"}}`,
+			want:    []string{"text/markdown:**加粗**"},
+		},
+		{
+			name:    "array keyboard",
+			payload: `{"action":"send_group_msg","params":{"group_id":868858989,"message":[{"type":"keyboard","data":{"content":{"rows":[{"buttons":[{"render_data":{"label":"打开"},"action":{"type":0,"data":"https://example.com"}}]}]}}}]}}`,
+			want:    []string{"text/markdown:**按钮**\n- `btn_ce219218` 打开 (跳转: <https://example.com>)"},
+		},
+		{
+			name:         "array node with nested content",
+			payload:      `{"action":"send_private_msg","params":{"user_id":2022717137,"message":[{"type":"node","data":{"name":"小明","uin":"10001","content":[{"type":"text","data":{"text":"嵌套"}},{"type":"face","data":{"id":"14"}}]}}]}}`,
+			want:         []string{"text:- 小明(10001): 嵌套[表情:微笑]\n"},
+			wantSegments: `[{"data":{"content":[{"data":{"text":"嵌套"},"type":"text"},{"data":{"id":"14"},"type":"face"}],"name":"小明","uin":"10001"},"type":"node"},{"data":{"id":"14"},"type":"face"}]`,
+		},
+		{
+			name:         "string node with escaped content",
+			payload:      `{"action":"send_private_msg","params":{"user_id":2022717137,"message":"[CQ:node,content=&#91;{\"type\":\"text\"&#44;\"data\":{\"text\":\"嵌套\"}}&#93;,name=小明,uin=10001]"}}`,
+			want:         []string{"text:- 小明(10001): 嵌套\n"},
+			wantSegments: `[{"data":{"content":[{"data":{"text":"嵌套"},"type":"text"}],"name":"小明","uin":"10001"},"type":"node"}]`,
+		},
+		{
+			name:         "string forward",
+			payload:      `{"action":"send_group_msg","params":{"group_id":868858989,"message":"[CQ:forward,id=abc123]"}}`,
+			want:         []string{"text:[合并转发:abc123]"},
+			wantSegments: `[{"data":{"id":"abc123"},"type":"forward"}]`,
+		},
+		{
+			name:         "string share with escaped comma",
+			payload:      `{"action":"send_private_msg","params":{"user_id":2022717137,"message":"[CQ:share,title=标题&#44;副标题,url=https://example.com]"}}`,
+			want:         []string{"text:[分享:标题,副标题 https://example.com]"},
+			wantSegments: `[{"data":{"title":"标题,副标题","url":"https://example.com"},"type":"share"}]`,
+		},
+		{
+			name:         "array share",
+			payload:      `{"action":"send_private_msg","params":{"user_id":2022717137,"message":[{"type":"share","data":{"title":"标题,副标题","url":"https://example.com"}}]}}`,
+			want:         []string{"text:[分享:标题,副标题 https://example.com]"},
+			wantSegments: `[{"data":{"title":"标题,副标题","url":"https://example.com"},"type":"share"}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var message callapi.ActionMessage
+			if err := json.Unmarshal([]byte(tt.payload), &message); err != nil {
+				t.Fatalf("unmarshal payload: %v", err)
+			}
+
+			ctx := NewContext(tt.acceptAudio, false, nil)
+			got := summarize(t, Render(ctx, Parse(message.Params.Message)))
+			if strings.Join(got, "\x00") != strings.Join(tt.want, "\x00") {
+				t.Errorf("contents\n got: %q\nwant: %q", got, tt.want)
+			}
+
+			gotSegments := ""
+			if segments, ok := ctx.Meta()["segments"]; ok {
+				data, err := json.Marshal(segments)
+				if err != nil {
+					t.Fatal(err)
+				}
+				gotSegments = string(data)
+			}
+			if gotSegments != tt.wantSegments {
+				t.Errorf("_meta.segments\n got: %s\nwant: %s", gotSegments, tt.wantSegments)
+			}
+		})
+	}
+}
+
+// TestRenderLoadFailure 加载失败的 base64 媒体在提示文本中只显示大小,不回显原始数据
+func TestRenderLoadFailure(t *testing.T) {
+	source := "base64://" + strings.Repeat("!", 64*1024)
+	segments := Parse("[CQ:image,file=" + source + "][CQ:record,file=" + source + "]")
+
+	got := summarize(t, Render(NewContext(false, false, nil), segments))
+	if len(got) != 2 {
+		t.Fatalf("contents = %q", got)
+	}
+	for _, text := range got {
+		if len(text) > 256 || !strings.Contains(text, "加载失败 base64://(48.0KB)") {
+			t.Errorf("load failure text = %q", text)
+		}
+	}
+}
+
+// TestRenderMediaMeta 图片与语音在结果 _meta 中记录大小与格式,重复的图片只返回一次
+func TestRenderMediaMeta(t *testing.T) {
+	pngSource := testPNG(t)
+	segments := Parse("[CQ:image,file=" + pngSource + "][CQ:image,file=" + pngSource + "][CQ:record,file=" + testWAV(t) + "]")
+
+	ctx := NewContext(true, false, nil)
+	got := summarize(t, Render(ctx, segments))
+	want := []string{"image:image/png", "audio:audio/wav"}
+	if strings.Join(got, "\x00") != strings.Join(want, "\x00") {
+		t.Fatalf("contents\n got: %q\nwant: %q", got, want)
+	}
+
+	meta := ctx.Meta()
+	images, _ := meta["images"].([]map[string]any)
+	if len(images) != 1 || images[0]["mime_type"] != "image/png" {
+		t.Errorf("_meta.images = %v", meta["images"])
+	}
+	records, _ := meta["records"].([]map[string]any)
+	if len(records) != 1 || records[0]["mime_type"] != "audio/wav" || records[0]["duration_ms"] != int64(1000) {
+		t.Errorf("_meta.records = %v", meta["records"])
+	}
+}
@@ -0,0 +1,93 @@
+// Package reply 将应用端回复的消息解析为有序的消息段,并转换为MCP工具结果
+package reply
+
+import (
+	"encoding/json"
+
+	"github.com/hoshinonyaruko/gensokyo-mcp/cq"
+	"github.com/hoshinonyaruko/gensokyo-mcp/media"
+)
+
+// SegmentType 消息段类型
+type SegmentType string
+
+const (
+	Text     SegmentType = "text"
+	Image    SegmentType = "image"
+	Record   SegmentType = "record"
+	Video    SegmentType = "video"
+	File     SegmentType = "file"
+	At       SegmentType = "at"
+	Reply    SegmentType = "reply"
+	Face     SegmentType = "face"
+	Markdown SegmentType = "markdown"
+	Keyboard SegmentType = "keyboard"
+	Forward  SegmentType = "forward"
+	Node     SegmentType = "node"
+	JSON     SegmentType = "json"
+	XML      SegmentType = "xml"
+	Share    SegmentType = "share"
+	Music    SegmentType = "music"
+	Poke     SegmentType = "poke"
+	Dice     SegmentType = "dice"
+	RPS      SegmentType = "rps"
+	Contact  SegmentType = "contact"
+	Location SegmentType = "location"
+	MFace    SegmentType = "mface"
+	Shake    SegmentType = "shake"
+)
+
+// Segment 一个消息段,Data 为段参数,非字符串参数以json文本保存
+type Segment struct {
+	Type SegmentType
+	Data map[string]string
+}
+
+// Get 返回段参数,不存在时为空
+func (s Segment) Get(key string) string {
+	return s.Data[key]
+}
+
+// CQ 转换为 cq 包的消息段
+func (s Segment) CQ() cq.Segment {
+	return cq.Segment{Type: string(s.Type), Data: s.Data}
+}
+
+// Structured 返回消息段的结构化形式 {"type":..., "data":...},
+// json 卡片与 node 中的json参数解析为对象,base64 数据只保留前缀
+func (s Segment) Structured() map[string]any {
+	data := make(map[string]any, len(s.Data))
+	for key, value := range s.Data {
+		data[key] = value
+		// base64 数据不放入结构化数据
+		if media.IsBase64(value) {
+			data[key] = media.Base64Prefix
+			continue
+		}
+		if (s.Type == JSON && key == "data") || (s.Type == Node && key == "content") {
+			var object any
+			if json.Unmarshal([]byte(value), &object) == nil {
+				data[key] = object
+			}
+		}
+	}
+	return map[string]any{"type": string(s.Type), "data": data}
+}
+
+// Parse 将 params.message 解析为消息段,支持CQ码字符串、消息段数组与单个消息段
+func Parse(message interface{}) []Segment {
+	cqSegments := cq.ParseMessage(message)
+	segments := make([]Segment, 0, len(cqSegments))
+	for _, segment := range cqSegments {
+		segments = append(segments, Segment{Type: normalizeType(segment.Type), Data: segment.Data})
+	}
+	return segments
+}
+
+// normalizeType 统一部分实现使用的别名
+func normalizeType(segmentType string) SegmentType {
+	if segmentType == "voice" {
+		return Record
+	}
+	return SegmentType(segmentType)
+}
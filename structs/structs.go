@@ -13,6 +13,11 @@ type Settings struct {
 	ReconnecTimes       int      `yaml:"reconnect_times"`
 	HeartBeatInterval   int      `yaml:"heart_beat_interval"`
 	LaunchReconectTimes int      `yaml:"launch_reconnect_times"`
+	//正向ws设置
+	WsServerAddress string `yaml:"ws_server_address"`
+	WsServerToken   string `yaml:"ws_server_token"`
+	//正向ws允许的网页来源
+	WsServerAllowedOrigins []string `yaml:"ws_server_allowed_origins"`
 	//基础配置
 	Uin              int64  `yaml:"uin"`
 	DisableErrorChan bool   `yaml:"disable_error_chan"`
@@ -20,8 +25,44 @@ type Settings struct {
 	EnableWsServer   bool   `yaml:"enable_ws_server"`
 	HttpAddress      string `yaml:"http_address"`
 	HttpOnlyBot      bool   `yaml:"http_only_bot"`
+	HttpAccessToken  string `yaml:"http_access_token"`
 	Array            bool   `yaml:"array"`
+	SortSegments     bool   `yaml:"sort_message_segments"`
 	NativeOb11       bool   `yaml:"native_ob11"`
 	StringOb11       bool   `yaml:"string_ob11"`
 	TimeOut          int    `yaml:"timeOut"`
+	MaxTimeOut       int    `yaml:"max_timeout"`
+	//http api允许的网页来源
+	HttpAllowedOrigins []string `yaml:"http_allowed_origins"`
+	//多条回复收集
+	CollectReplies     bool `yaml:"collect_replies"`
+	CollectWindow      int  `yaml:"collect_window"`
+	CollectMaxWait     int  `yaml:"collect_max_wait"`
+	CollectMaxMessages int  `yaml:"collect_max_messages"`
+	//回复图片限制
+	ImageMaxCount   int `yaml:"image_max_count"`
+	ImageMaxTotalKB int `yaml:"image_max_total_kb"`
+	//回复图片压缩
+	ImageCompressThresholdKB int `yaml:"image_compress_threshold_kb"`
+	ImageMaxDimension        int `yaml:"image_max_dimension"`
+	ImageMinQuality          int `yaml:"image_min_quality"`
+	ImageMaxQuality          int `yaml:"image_max_quality"`
+	//语音回复
+	AudioAsText bool `yaml:"audio_as_text"`
+	//媒体下载
+	MediaFetchTimeout int  `yaml:"media_fetch_timeout"`
+	MediaMaxKB        int  `yaml:"media_max_kb"`
+	MediaMaxRedirects int  `yaml:"media_max_redirects"`
+	MediaBlockPrivate bool `yaml:"media_block_private"`
+	//媒体缓存
+	MediaCache        bool   `yaml:"media_cache"`
+	MediaCacheDir     string `yaml:"media_cache_dir"`
+	MediaCacheQuotaMB int    `yaml:"media_cache_quota_mb"`
+	MediaLinks        bool   `yaml:"media_links"`
+	//markdown模板
+	MarkdownTemplateDir string `yaml:"markdown_template_dir"`
+	//消息库
+	MessageRetention int `yaml:"message_retention"`
+	//模拟数据
+	FixturesFile string `yaml:"fixtures_file"`
 }
@@ -10,12 +10,48 @@ settings:
   heart_beat_interval : 5          #反向ws心跳间隔 单位秒 推荐5-10
   launch_reconnect_times : 1        #启动时尝试反向ws连接次数,建议先打开应用端再开启gensokyo,因为启动时连接会阻塞webui启动,默认只连接一次,可自行增大
 
+  #正向ws设置
+  enable_ws_server : false          #是否启动正向ws服务器,应用端可连接 / (事件与api) /api (仅api) /event (仅事件).
+  ws_server_address : "127.0.0.1:15630" #正向ws服务器的监听地址.
+  ws_server_token : ""              #正向ws服务器的access_token,应用端以 Authorization: Bearer <token> 或 ?access_token= 传入,留空则不验证.
+  ws_server_allowed_origins : []    #未设置ws_server_token时,允许连接正向ws的网页来源,如 ["http://127.0.0.1:8080"],应用端不受影响,其他网页的连接会被拒绝.
+
+  #http api设置
+  http_address : ""                 #http api的监听地址,如 "127.0.0.1:15640",留空则不启动,应用端以 POST /<action> 或 GET /<action>?参数 调用api.
+  http_access_token : ""            #http api的access_token,传入方式与正向ws相同,留空则不验证.
+  http_allowed_origins : []         #未设置http_access_token时,允许调用http api的网页来源,如 ["http://127.0.0.1:8080"],应用端不受影响,其他网页的请求会被拒绝.
+
   #基础设置
   uin : 0                                            # 你的机器人QQ号
   timeOut : 4                                          # 等待反向ws信息超时时间,默认4秒,当超时时,可以触发默认回复,引导用户。
+  max_timeout : 60                  #call_ws的timeout参数允许的最大值 单位秒,防止单次调用长时间占用.
+  collect_replies : false           #开启后call_ws收到首条回复后继续收集,直到bot静默,适合一次回复多条信息的插件.可被工具参数collect覆盖.
+  collect_window : 1500             #收集模式下的静默窗口 单位毫秒,超过该时间没有新回复即结束收集.
+  collect_max_wait : 20             #收集模式下从首条回复开始的最长收集时间 单位秒.
+  collect_max_messages : 10         #收集模式下最多收集的回复条数.
+  image_max_count : 9               #单次工具结果最多返回的图片数量,重复图片只计一次.
+  image_max_total_kb : 10240        #单次工具结果中图片的总体积上限 单位KB,超出的图片会被省略并提示.
+  image_compress_threshold_kb : 512 #图片超过该体积时以jpeg降低质量压缩 单位KB,0为不压缩.
+  image_max_dimension : 2048        #图片最长边超过该像素时等比缩小,0为不缩放,gif只压缩不缩放.
+  image_min_quality : 25            #压缩时jpeg质量的下限 1-100.
+  image_max_quality : 75            #压缩时jpeg质量的上限 1-100,从上限开始逐步降低直到低于阈值.
+  audio_as_text : false             #客户端不支持音频内容时开启,语音回复以格式/时长等文本描述返回,可被工具参数accept_audio覆盖.
+  media_fetch_timeout : 10          #下载回复中http图片/语音的超时时间 单位秒.
+  media_max_kb : 20480              #单个媒体文件的最大体积 单位KB,超出时以文本提示代替.
+  media_max_redirects : 5           #下载媒体时最多跟随的重定向次数.
+  media_block_private : false       #禁止下载内网/回环地址的媒体,bot与应用端在同一内网时请保持关闭.
+  media_cache : false               #将回复中的图片/语音按sha256缓存到本地,并以 onebot-media://sha256/... 资源发布,修改后需重启.
+  media_cache_dir : "media_cache"   #媒体缓存目录.
+  media_cache_quota_mb : 256        #媒体缓存的磁盘配额 单位MB,超出时淘汰最久未使用的文件.
+  media_links : false               #工具结果中以资源链接代替内联的图片/语音,客户端按需读取资源,可被工具参数media_links覆盖.
+  message_retention : 10000         #消息库(get_msg/delete_msg使用)保留最近多少条消息,超出时删除最早的消息,-1为不限制.
+  markdown_template_dir : "markdown_templates" #markdown模板目录,模板markdown按 <模板id>.md 读取模板并填充参数,留空则只列出模板参数.
+  fixtures_file : "fixtures.yml"    #模拟数据文件,定义群、群成员、好友、频道与机器人资料,用于响应查询类api,修改后自动重载.
   disable_error_chan : false        #禁用ws断开时候将信息放入补发频道,当信息非常多时可能导致冲垮应用端,可以设置本选项为true.
   string_ob11 : false               #api不再返回转换后的int类型,而是直接转换,需应用端适配.
   string_action : false             #开启后将兼容action调用中使用string形式的user_id和group_id.
+  array : false                     #以消息段数组格式上报message,payload中的CQ码会转换为对应的at/image/face/reply等消息段,raw_message仍为CQ码.
+  sort_message_segments : false     #数组格式下将消息段按 at,文本,图片,其他 的顺序重新排列,兼容依赖该顺序的旧插件.
   title : "gensokyo-mcp © 2025 - Hoshinonyaruko"              #程序的标题 如果多个机器人 可根据标题区分
 `
 const Logo = `
@@ -0,0 +1,48 @@
+package template
+
+// FixturesTemplate 默认的模拟数据文件,查询类api按此响应
+const FixturesTemplate = `# gensokyo-mcp 模拟数据 修改后自动重载
+# id 均以字符串填写,上报时按 string_ob11 设置转换为int或string
+
+# 机器人自身资料 get_login_info,user_id 为配置中的 uin
+self:
+  nickname: "早苗"
+
+# 版本信息 get_version_info
+version:
+  app_name: "gensokyo-mcp"
+  app_version: "v1.0.0"
+  protocol_version: "v11"
+
+# 群列表 get_group_list,members 为群成员
+# role 为 owner(群主) admin(管理员) member(成员),card 为群名片
+groups:
+  - group_id: "868858989"
+    group_name: "可爱red"
+    group_memo: ""
+    max_member_count: 3000
+    member_count: 1800          # 留空时为 members 的数量
+    members:
+      - user_id: "2022717137"
+        nickname: "小狐狸"
+        card: "群主小狐狸"
+        role: "owner"
+        sex: "unknown"
+        age: 0
+        area: ""
+        level: "1"
+        title: ""
+
+# 好友列表 get_friend_list
+friends:
+  - user_id: "2022717137"
+    nickname: "小狐狸"
+    remark: ""
+
+# 频道列表 get_guild_list,channels 为子频道 get_guild_channel_list
+guilds:
+  - guild_id: "0"
+    guild_name: "868858989"
+    guild_display_id: "868858989"
+    channels: []
+`
@@ -0,0 +1,320 @@
+package wsclient
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo-mcp/callapi"
+	"github.com/hoshinonyaruko/gensokyo-mcp/mylog"
+)
+
+// ConversationKey 标识一次调用所属的会话
+type ConversationKey struct {
+	SelfID      string // 机器人 self_id
+	MessageType string // group / private
+	GroupID     string // 私聊时为空
+	UserID      string
+}
+
+// route 同一路由下的回复无法仅凭 action 区分来源(send_group_msg 通常不带 user_id),
+// 因此群聊按群路由,私聊按用户路由,同一路由下的调用串行进行
+func (k ConversationKey) route() string {
+	if k.MessageType == "private" {
+		return fmt.Sprintf("%s:private:%s", k.SelfID, k.UserID)
+	}
+	return fmt.Sprintf("%s:group:%s", k.SelfID, k.GroupID)
+}
+
+// String 作为 pendingMessages 的键
+func (k ConversationKey) String() string {
+	return k.route()
+}
+
+// Waiter 一次调用的回复等待者,持有本次上报事件的 message_id
+type Waiter struct {
+	Key       ConversationKey
+	MessageID string
+	// SettleWindow 释放后继续占用路由,直到该路由静默这么久,
+	// 避免本次调用迟到的回复被下一次调用认领,只在收集模式下设置
+	SettleWindow time.Duration
+	ch           chan callapi.ActionMessage
+	lock         *routeLock
+	once         sync.Once
+}
+
+// routeLock 路由的占用令牌,同一时刻只有一个 Waiter 持有,
+// 持有与等待的调用都结束后从 routeLocks 中删除
+type routeLock struct {
+	token chan struct{}
+	// refs 持有与等待该令牌的调用数
+	refs int
+	// lastReplyAt 该路由最近一次收到回复的时间
+	lastReplyAt time.Time
+}
+
+var (
+	routeMutex sync.Mutex
+	// routeLocks 正在使用的路由
+	routeLocks = make(map[string]*routeLock)
+	// activeWaiters 当前持有路由的 Waiter
+	activeWaiters = make(map[string]*Waiter)
+)
+
+// replyIDPattern 匹配回复中引用的 message_id
+var replyIDPattern = regexp.MustCompile(`\[CQ:reply,id=(-?\d+)`)
+
+// RegisterWaiter 在上报事件之前登记等待者,若同一路由上已有调用在进行,
+// 则最多等待 timeout 直到其释放。调用方必须在结束后调用 Release。
+func RegisterWaiter(key ConversationKey, messageID string, timeout time.Duration) (*Waiter, error) {
+	route := key.route()
+
+	routeMutex.Lock()
+	lock, ok := routeLocks[route]
+	if !ok {
+		lock = &routeLock{token: make(chan struct{}, 1)}
+		routeLocks[route] = lock
+	}
+	lock.refs++
+	routeMutex.Unlock()
+
+	select {
+	case lock.token <- struct{}{}:
+	case <-time.After(timeout):
+		unrefRoute(route, lock)
+		return nil, fmt.Errorf("timeout waiting for route %s to be released", route)
+	}
+
+	w := &Waiter{
+		Key:       key,
+		MessageID: messageID,
+		ch:        make(chan callapi.ActionMessage, 32),
+		lock:      lock,
+	}
+
+	mapMutex.Lock()
+	activeWaiters[route] = w
+	mapMutex.Unlock()
+
+	return w, nil
+}
+
+// Wait 等待本次调用的首条回复或超时
+func (w *Waiter) Wait(timeout time.Duration) (*callapi.ActionMessage, error) {
+	select {
+	case msg := <-w.ch:
+		return &msg, nil
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("timeout waiting for reply of message %s in %s", w.MessageID, w.Key.route())
+	}
+}
+
+// Collect 等待首条回复(最多 timeout),之后持续收集,直到 window 内没有新回复、
+// 自首条回复起超过 maxWait 或收满 maxMessages 条为止,按到达顺序返回
+func (w *Waiter) Collect(timeout, window, maxWait time.Duration, maxMessages int) ([]callapi.ActionMessage, error) {
+	first, err := w.Wait(timeout)
+	if err != nil {
+		return nil, err
+	}
+	messages := []callapi.ActionMessage{*first}
+
+	deadline := time.Now().Add(maxWait)
+	for len(messages) < maxMessages {
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			break
+		}
+		if wait > window {
+			wait = window
+		}
+
+		select {
+		case msg := <-w.ch:
+			messages = append(messages, msg)
+		case <-time.After(wait):
+			// bot 已静默或到达最长收集时间
+			return messages, nil
+		}
+	}
+
+	return messages, nil
+}
+
+// Release 释放路由,未被取走的回复转入 pendingMessages
+func (w *Waiter) Release() {
+	w.once.Do(func() {
+		route := w.Key.route()
+
+		mapMutex.Lock()
+		if activeWaiters[route] == w {
+			delete(activeWaiters, route)
+		}
+		mapMutex.Unlock()
+
+		// 把已投递但未读取的回复留作历史信息
+		for drained := false; !drained; {
+			select {
+			case msg := <-w.ch:
+				AddMessageToPending(route, &msg)
+			default:
+				drained = true
+			}
+		}
+
+		if w.SettleWindow <= 0 {
+			<-w.lock.token
+			unrefRoute(route, w.lock)
+			return
+		}
+		// 异步等待路由静默后再交出,最长等待 4 个窗口
+		go func() {
+			deadline := time.Now().Add(4 * w.SettleWindow)
+			for {
+				routeMutex.Lock()
+				quietAt := w.lock.lastReplyAt.Add(w.SettleWindow)
+				routeMutex.Unlock()
+
+				wait := time.Until(quietAt)
+				if wait <= 0 || time.Now().After(deadline) {
+					break
+				}
+				time.Sleep(wait)
+			}
+			<-w.lock.token
+			unrefRoute(route, w.lock)
+		}()
+	})
+}
+
+// unrefRoute 一次调用不再持有或等待路由,路由空闲时删除
+func unrefRoute(route string, lock *routeLock) {
+	routeMutex.Lock()
+	defer routeMutex.Unlock()
+	lock.refs--
+	if lock.refs == 0 && routeLocks[route] == lock {
+		delete(routeLocks, route)
+	}
+}
+
+// replyKeyOf 从应用端的 send 类 action 推导其所属会话
+func replyKeyOf(selfID uint64, message callapi.ActionMessage) ConversationKey {
+	key := ConversationKey{
+		SelfID:      strconv.FormatUint(selfID, 10),
+		MessageType: "group",
+	}
+	key.UserID, _ = message.Params.UserID.(string)
+	if IsPrivateAction(message) {
+		key.MessageType = "private"
+		return key
+	}
+	key.GroupID, _ = message.Params.GroupID.(string)
+	return key
+}
+
+// referencedMessageID 返回回复中引用的 message_id(reply 段),没有则为空
+func referencedMessageID(message callapi.ActionMessage) string {
+	switch msg := message.Params.Message.(type) {
+	case string:
+		if match := replyIDPattern.FindStringSubmatch(msg); match != nil {
+			return match[1]
+		}
+	case []interface{}:
+		for _, segment := range msg {
+			segmentMap, ok := segment.(map[string]interface{})
+			if !ok || segmentMap["type"] != "reply" {
+				continue
+			}
+			data, _ := segmentMap["data"].(map[string]interface{})
+			switch id := data["id"].(type) {
+			case string:
+				return id
+			case float64:
+				return strconv.FormatFloat(id, 'f', -1, 64)
+			}
+		}
+	}
+	return ""
+}
+
+// requestFlagTTL 请求事件 flag 的保留时间
+const requestFlagTTL = 10 * time.Minute
+
+type requestFlag struct {
+	key       ConversationKey
+	createdAt time.Time
+}
+
+var (
+	requestFlagsMu sync.Mutex
+	// requestFlags 上报的请求事件 flag 对应的会话,用于认领 set_*_request
+	requestFlags = make(map[string]requestFlag)
+)
+
+// RegisterRequestFlag 登记请求事件的 flag,应用端处理该请求时投递到 key 所属的会话
+func RegisterRequestFlag(flag string, key ConversationKey) {
+	requestFlagsMu.Lock()
+	defer requestFlagsMu.Unlock()
+	for f, entry := range requestFlags {
+		if time.Since(entry.createdAt) > requestFlagTTL {
+			delete(requestFlags, f)
+		}
+	}
+	requestFlags[flag] = requestFlag{key: key, createdAt: time.Now()}
+}
+
+// DispatchRequestReply 将 set_friend_add_request/set_group_add_request 投递给上报该请求的会话,
+// 不是本程序上报的 flag 时忽略
+func DispatchRequestReply(message callapi.ActionMessage) {
+	requestFlagsMu.Lock()
+	entry, ok := requestFlags[message.Params.Flag]
+	delete(requestFlags, message.Params.Flag)
+	requestFlagsMu.Unlock()
+	if ok {
+		deliverReply(entry.key, message)
+	}
+}
+
+// DispatchReply 将回复投递给对应的 Waiter,无人认领时放入 pendingMessages
+func DispatchReply(selfID uint64, message callapi.ActionMessage) {
+	deliverReply(replyKeyOf(selfID, message), message)
+}
+
+func deliverReply(key ConversationKey, message callapi.ActionMessage) {
+	route := key.route()
+
+	// 持锁投递,保证与 Release 的清理互斥
+	mapMutex.Lock()
+	defer mapMutex.Unlock()
+
+	// 只有正在使用的路由需要记录回复时间
+	routeMutex.Lock()
+	if lock, ok := routeLocks[route]; ok {
+		lock.lastReplyAt = time.Now()
+	}
+	routeMutex.Unlock()
+
+	w, ok := activeWaiters[route]
+	if ok {
+		// 群回复带了 user_id 但不是本次调用的用户,不属于本次调用
+		if key.MessageType == "group" && key.UserID != "" && key.UserID != w.Key.UserID {
+			ok = false
+		}
+		// 引用了其他事件的 message_id,视为迟到的回复
+		if refID := referencedMessageID(message); refID != "" && refID != w.MessageID {
+			ok = false
+		}
+	}
+
+	if ok {
+		select {
+		case w.ch <- message:
+			return
+		default:
+			mylog.Printf("reply channel of message %s is full", w.MessageID)
+		}
+	}
+
+	AddMessageToPending(route, &message)
+}
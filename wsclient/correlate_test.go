@@ -0,0 +1,132 @@
+package wsclient
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hoshinonyaruko/gensokyo-mcp/callapi"
+)
+
+// groupReply 应用端在群 groupID 中发出的回复
+func groupReply(groupID, text string) callapi.ActionMessage {
+	return callapi.ActionMessage{
+		Action: "send_group_msg",
+		Params: callapi.ParamsContent{GroupID: groupID, Message: text},
+	}
+}
+
+// groupKey 群 groupID 中用户 userID 的会话
+func groupKey(groupID, userID string) ConversationKey {
+	return ConversationKey{SelfID: "1", MessageType: "group", GroupID: groupID, UserID: userID}
+}
+
+// takePending 取出并清空路由的 pendingMessages
+func takePending(route string) []callapi.ActionMessage {
+	pendingMutex.Lock()
+	defer pendingMutex.Unlock()
+	msgs := pendingMessages[route]
+	delete(pendingMessages, route)
+	return msgs
+}
+
+// TestRegisterWaiterSerializesRoute 同一群的调用依次进行,不同群的调用互不等待
+func TestRegisterWaiterSerializesRoute(t *testing.T) {
+	first, err := RegisterWaiter(groupKey("100", "1"), "11", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 其他群不受影响
+	other, err := RegisterWaiter(groupKey("200", "1"), "21", 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("other group blocked: %v", err)
+	}
+	other.Release()
+
+	// 同一群的第二次调用等待第一次释放
+	if _, err := RegisterWaiter(groupKey("100", "2"), "12", 50*time.Millisecond); err == nil {
+		t.Fatal("second call in the same group did not wait for the first")
+	}
+	acquired := make(chan *Waiter, 1)
+	go func() {
+		w, err := RegisterWaiter(groupKey("100", "2"), "12", time.Second)
+		if err != nil {
+			t.Error(err)
+		}
+		acquired <- w
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("second call acquired the route before release")
+	case <-time.After(50 * time.Millisecond):
+	}
+	first.Release()
+	second := <-acquired
+	if second == nil {
+		return
+	}
+	second.Release()
+
+	routeMutex.Lock()
+	defer routeMutex.Unlock()
+	if len(routeLocks) != 0 {
+		t.Errorf("routeLocks not pruned: %v", routeLocks)
+	}
+}
+
+// TestDispatchReplyToWaiter 回复投递给持有路由的调用,引用了其他消息的回复转入 pendingMessages
+func TestDispatchReplyToWaiter(t *testing.T) {
+	key := groupKey("300", "1")
+	w, err := RegisterWaiter(key, "31", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer takePending(key.route())
+
+	deliverReply(key, groupReply("300", "[CQ:reply,id=30]迟到的回复"))
+	deliverReply(key, groupReply("300", "[CQ:reply,id=31]本次回复"))
+	deliverReply(key, groupReply("300", "没有引用"))
+
+	got, err := w.Collect(time.Second, 20*time.Millisecond, time.Second, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Release()
+	if len(got) != 2 || got[0].Params.Message != "[CQ:reply,id=31]本次回复" || got[1].Params.Message != "没有引用" {
+		t.Errorf("collected %v", got)
+	}
+	if pending := takePending(key.route()); len(pending) != 1 || pending[0].Params.Message != "[CQ:reply,id=30]迟到的回复" {
+		t.Errorf("pending %v", pending)
+	}
+}
+
+// TestReleaseSettleWindow 收集模式下释放后,路由静默一个窗口才交给下一次调用,
+// 迟到的回复不会被下一次调用认领
+func TestReleaseSettleWindow(t *testing.T) {
+	key := groupKey("400", "1")
+	first, err := RegisterWaiter(key, "41", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer takePending(key.route())
+	first.SettleWindow = 100 * time.Millisecond
+	first.Release()
+
+	// 释放后迟到的回复进入 pendingMessages
+	deliverReply(key, groupReply("400", "迟到的回复"))
+
+	start := time.Now()
+	second, err := RegisterWaiter(key, "42", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Release()
+	if waited := time.Since(start); waited < 80*time.Millisecond {
+		t.Errorf("route handed over after %v, want the settle window", waited)
+	}
+	select {
+	case msg := <-second.ch:
+		t.Errorf("late reply delivered to the next call: %v", msg)
+	default:
+	}
+}
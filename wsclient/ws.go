@@ -7,7 +7,6 @@ import (
 	"log"
 	"net/http"
 	"net/url"
-	"strings"
 	"sync"
 	"time"
 
@@ -15,17 +14,13 @@ import (
 	"github.com/hoshinonyaruko/gensokyo-mcp/botstats"
 	"github.com/hoshinonyaruko/gensokyo-mcp/callapi"
 	"github.com/hoshinonyaruko/gensokyo-mcp/config"
-	"github.com/hoshinonyaruko/gensokyo-mcp/multid"
 	"github.com/hoshinonyaruko/gensokyo-mcp/mylog"
 	"github.com/hoshinonyaruko/gensokyo-mcp/praser"
 )
 
 var (
-	// echoToChanMap 用于存储期待特定 echo 值的消息的通道
-	echoToChanMap = make(map[string]chan callapi.ActionMessage)
-	// generalChan 用于处理那些echo值不是字符串的消息
-	generalChan = make(chan callapi.ActionMessage, 10)
-	mapMutex    sync.Mutex
+	// mapMutex 保护 activeWaiters
+	mapMutex sync.Mutex
 )
 
 // pendingMessages：新增，用于存储超时后/重复的消息
@@ -233,59 +228,24 @@ func (client *WebSocketClient) recvMessage(msg []byte) {
 	}
 	mylog.Println("Received from onebotv11 server:", TruncateMessage(message, 800))
 
-	// 判断Action是否以"send"开头
-	if !strings.HasPrefix(message.Action, "send") {
-		// 如果不是以"send"开头，记录日志并返回
-		mylog.Printf("Action '%s' is not supported, ignored.", message.Action)
-		client.respondToAction(message.Action, message.Echo)
-		return
-	}
-
-	// string模式支持bind
-	if config.GetStringOb11() {
-		message.Params.UserID = multid.GetOriginIDFromActiveID(message.Params.UserID.(string))
-	}
-
-	mapMutex.Lock()
-	defer mapMutex.Unlock()
-
-	var echoKey string
-	if !config.GetStringOb11() {
-		echoKey = message.Params.UserID.(string)
-	} else {
-		// 如果双向Echo启用，根据echo的值处理消息
-		echoKey = message.Params.UserID.(string)
-	}
-
-	if ch, ok := echoToChanMap[echoKey]; ok {
-		// 如果找到匹配的信道，则发送消息
-		ch <- message
-		// 从映射中移除已处理的echo
-		delete(echoToChanMap, echoKey)
-	} else {
-		pendingMutex.Lock()
-		pendingMessages[echoKey] = append(pendingMessages[echoKey], message)
-		pendingMutex.Unlock()
-	}
+	// 按action分发给注册的handler,未注册的action以 retcode 1404 响应
+	callapi.CallAPIFromDict(client, message)
 }
 
-// WaitForActionMessage 等待特定echo值的消息或超时
-func WaitForActionMessage(userid string, timeout time.Duration) (*callapi.ActionMessage, error) {
-	ch := make(chan callapi.ActionMessage, 1)
-
-	mapMutex.Lock()
-	echoToChanMap[userid] = ch
-	mapMutex.Unlock()
-
-	select {
-	case msg := <-ch:
-		return &msg, nil
-	case <-time.After(timeout):
-		mapMutex.Lock()
-		delete(echoToChanMap, userid)
-		mapMutex.Unlock()
-		return nil, fmt.Errorf("timeout waiting for message with echo %s", userid)
+// IsPrivateAction 判断send类action是否为私聊回复
+func IsPrivateAction(message callapi.ActionMessage) bool {
+	switch message.Action {
+	case "send_private_msg", "send_private_forward_msg":
+		return true
+	case "send_msg", "send_forward_msg":
+		if message.Params.MsgType != "" {
+			return message.Params.MsgType == "private"
+		}
+		// 未指定message_type时,没有group_id即视为私聊
+		groupID, _ := message.Params.GroupID.(string)
+		return groupID == ""
 	}
+	return false
 }
 
 // 截断信息
@@ -304,6 +264,40 @@ func TruncateMessage(message callapi.ActionMessage, maxLength int) string {
 	return fmt.Sprintf("Action: %s, Params: %s, Echo: %v", message.Action, truncatedParams, message.Echo)
 }
 
+// HeartbeatMessage 心跳元事件 interval 为心跳间隔 单位秒
+func HeartbeatMessage(botID uint64, interval int) map[string]interface{} {
+	messageReceived, messageSent, lastMessageTime, err := botstats.GetStats()
+	if err != nil {
+		mylog.Printf("心跳错误,获取机器人发信状态错误:%v", err)
+	}
+	message := map[string]interface{}{
+		"post_type":       "meta_event",
+		"meta_event_type": "heartbeat",
+		"time":            int(time.Now().Unix()),
+		"self_id":         botID,
+		"status": map[string]interface{}{
+			"app_enabled":     true,
+			"app_good":        true,
+			"app_initialized": true,
+			"good":            true,
+			"online":          true,
+			"plugins_good":    nil,
+			"stat": map[string]int{
+				"packet_received":   34933,
+				"packet_sent":       8513,
+				"packet_lost":       0,
+				"message_received":  messageReceived,
+				"message_sent":      messageSent,
+				"disconnect_times":  0,
+				"lost_times":        0,
+				"last_message_time": int(lastMessageTime),
+			},
+		},
+		"interval": interval * 1000, // 以毫秒为单位
+	}
+	return message
+}
+
 // 发送心跳包
 func (client *WebSocketClient) sendHeartbeat(ctx context.Context, botID uint64, heartbeatinterval int) {
 	for {
@@ -311,35 +305,7 @@ func (client *WebSocketClient) sendHeartbeat(ctx context.Context, botID uint64,
 		case <-ctx.Done():
 			return
 		case <-time.After(time.Duration(heartbeatinterval) * time.Second):
-			messageReceived, messageSent, lastMessageTime, err := botstats.GetStats()
-			if err != nil {
-				mylog.Printf("心跳错误,获取机器人发信状态错误:%v", err)
-			}
-			message := map[string]interface{}{
-				"post_type":       "meta_event",
-				"meta_event_type": "heartbeat",
-				"time":            int(time.Now().Unix()),
-				"self_id":         botID,
-				"status": map[string]interface{}{
-					"app_enabled":     true,
-					"app_good":        true,
-					"app_initialized": true,
-					"good":            true,
-					"online":          true,
-					"plugins_good":    nil,
-					"stat": map[string]int{
-						"packet_received":   34933,
-						"packet_sent":       8513,
-						"packet_lost":       0,
-						"message_received":  messageReceived,
-						"message_sent":      messageSent,
-						"disconnect_times":  0,
-						"lost_times":        0,
-						"last_message_time": int(lastMessageTime),
-					},
-				},
-				"interval": 5000, // 以毫秒为单位
-			}
+			message := HeartbeatMessage(botID, heartbeatinterval)
 			client.SendMessage(message)
 			// 重发失败的消息
 			client.processFailedMessages()
@@ -459,148 +425,6 @@ func getParamsFromURI(uriStr string) map[string]string {
 	return params
 }
 
-// respondToAction 根据action类型构造并发送响应消息
-func (client *WebSocketClient) respondToAction(action string, echo interface{}) {
-	var response map[string]interface{}
-
-	switch action {
-	case "get_group_list":
-		response = make(map[string]interface{})
-		data := make([]map[string]interface{}, 1) // 示例仅创建一个元素的数组
-		for i := range data {
-			data[i] = map[string]interface{}{
-				"group_create_time": "0",
-				"group_id":          "868858989",
-				"group_level":       "0",
-				"group_memo":        "",
-				"group_name":        "可爱red",
-				"max_member_count":  "3000",
-				"member_count":      "1800",
-			}
-		}
-		response["data"] = data
-		response["message"] = ""
-		response["retcode"] = 0
-		response["status"] = "ok"
-		response["echo"] = echo
-
-	case "get_login_info":
-		wxappidint := config.GetUinint64()
-		response = map[string]interface{}{
-			"data": map[string]interface{}{
-				"nickname": "早苗",
-				"user_id":  wxappidint,
-			},
-			"message": "",
-			"retcode": 0,
-			"status":  "ok",
-			"echo":    echo,
-		}
-
-	case "get_guild_service_profile":
-		response = map[string]interface{}{
-			"data": map[string]interface{}{
-				"nickname": "",
-				"tiny_id":  0,
-			},
-			"message": "",
-			"retcode": 0,
-			"status":  "ok",
-			"echo":    echo,
-		}
-
-	case "get_online_clients":
-		response = map[string]interface{}{
-			"data": map[string]interface{}{
-				"clients": []interface{}{}, // 创建一个空的clients数组
-				"tiny_id": 0,
-			},
-			"message": "",
-			"retcode": 0,
-			"status":  "ok",
-			"echo":    echo,
-			"clients": []interface{}{}, // 根据描述，这可能是多余的，除非您有特定需求
-		}
-
-	case "get_version_info":
-		response = map[string]interface{}{
-			"data": map[string]interface{}{
-				"app_full_name":              "go-cqhttp-v1.0.0_windows_amd64-go1.20.2",
-				"app_name":                   "go-cqhttp",
-				"app_version":                "v1.0.0",
-				"coolq_directory":            "",
-				"coolq_edition":              "pro",
-				"go-cqhttp":                  true,
-				"plugin_build_configuration": "release",
-				"plugin_build_number":        99,
-				"plugin_version":             "4.15.0",
-				"protocol_name":              4,
-				"protocol_version":           "v11",
-				"runtime_os":                 "windows",
-				"runtime_version":            "go1.20.2",
-				"version":                    "v1.0.0",
-			},
-			"message": "",
-			"retcode": 0,
-			"status":  "ok",
-			"echo":    echo,
-		}
-
-	case "get_friend_list":
-		friends := []map[string]interface{}{
-			{"nickname": "小狐狸", "remark": "", "user_id": "2022717137"},
-			// 添加更多好友信息...
-		}
-		response = map[string]interface{}{
-			"data":    friends,
-			"message": "",
-			"retcode": 0,
-			"status":  "ok",
-			"echo":    echo,
-		}
-
-	case "get_guild_list":
-		data := []map[string]interface{}{}
-		// 假设我们要添加一个示例公会信息，实际应用中这部分可能需要从数据库或其他数据源动态获取
-		for i := 0; i < 1; i++ { // 示例仅添加一个公会
-			data = append(data, map[string]interface{}{
-				"guild_id":         "0",         // 公会ID示例值
-				"guild_name":       "868858989", // 公会名称示例值
-				"guild_display_id": "868858989", // 公会显示ID示例值
-			})
-		}
-		response = map[string]interface{}{
-			"data":    data,
-			"message": "",
-			"retcode": 0,
-			"status":  "ok",
-			"echo":    echo,
-		}
-
-	case "get_guild_channel_list":
-		// 这里示例不具体填充data数组中的频道信息，假设响应需要的是一个空的频道列表
-		response = map[string]interface{}{
-			"data":    []interface{}{}, // 创建一个空的频道列表
-			"message": "",
-			"retcode": 0,
-			"status":  "ok",
-			"echo":    echo,
-		}
-
-	default:
-		mylog.Printf("Action '%s' is not supported, ignored.", action)
-		return
-	}
-
-	err := client.SendMessage(response)
-	if err != nil {
-		mylog.Println("Error sending message:", err)
-		return
-	}
-
-	mylog.Printf("Responded to action '%s' with: %v", action, response)
-}
-
 // GetPendingMessages：获取并删除最近的溢出消息，并检查字数是否超过2047
 func GetPendingMessages(userid string, clear bool, currentLength int) ([]callapi.ActionMessage, int, error) {
 	// 锁定 pendingMessages 保证并发安全
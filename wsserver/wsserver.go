@@ -0,0 +1,176 @@
+// 正向ws服务器 应用端连接到本程序接收事件与调用api
+package wsserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/hoshinonyaruko/gensokyo-mcp/callapi"
+	"github.com/hoshinonyaruko/gensokyo-mcp/config"
+	"github.com/hoshinonyaruko/gensokyo-mcp/handlers"
+	"github.com/hoshinonyaruko/gensokyo-mcp/mylog"
+	"github.com/hoshinonyaruko/gensokyo-mcp/wsclient"
+)
+
+// 连接的角色,与 OneBot 正向ws的三个端点对应
+const (
+	roleUniversal = "Universal" // / 事件与api
+	roleAPI       = "API"       // /api 仅api
+	roleEvent     = "Event"     // /event 仅事件
+)
+
+// writeTimeout 单条消息的写超时
+const writeTimeout = 10 * time.Second
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool {
+		return handlers.CheckOrigin(r, config.GetWsServerToken(), config.GetWsServerAllowedOrigins())
+	},
+}
+
+// WebSocketServerClient 连接到正向ws服务器的应用端
+type WebSocketServerClient struct {
+	conn      *websocket.Conn
+	role      string
+	writeMu   sync.Mutex
+	closeCh   chan struct{}
+	closeOnce sync.Once
+}
+
+var (
+	clientsMu sync.RWMutex
+	// clients 接收事件的连接
+	clients = make(map[*WebSocketServerClient]struct{})
+)
+
+// SendMessage 发送消息,同一连接的写操作串行执行
+func (c *WebSocketServerClient) SendMessage(message map[string]interface{}) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return c.conn.WriteJSON(message)
+}
+
+// Close 关闭连接,停止心跳
+func (c *WebSocketServerClient) Close() error {
+	c.closeOnce.Do(func() { close(c.closeCh) })
+	return c.conn.Close()
+}
+
+// EventClients 返回接收事件的连接(/ 与 /event)
+func EventClients() []callapi.WebSocketServerClienter {
+	clientsMu.RLock()
+	defer clientsMu.RUnlock()
+	list := make([]callapi.WebSocketServerClienter, 0, len(clients))
+	for client := range clients {
+		list = append(list, client)
+	}
+	return list
+}
+
+// Handler 正向ws服务器的路由
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		serve(w, r, roleUniversal)
+	})
+	mux.HandleFunc("/api", func(w http.ResponseWriter, r *http.Request) {
+		serve(w, r, roleAPI)
+	})
+	mux.HandleFunc("/event", func(w http.ResponseWriter, r *http.Request) {
+		serve(w, r, roleEvent)
+	})
+	return mux
+}
+
+// ListenAndServe 在 address 上启动正向ws服务器
+func ListenAndServe(address string) error {
+	mylog.Printf("正向ws服务器已启动: ws://%s", address)
+	return http.ListenAndServe(address, Handler())
+}
+
+// serve 校验access_token后升级为ws连接,按角色上报事件与处理api调用
+func serve(w http.ResponseWriter, r *http.Request, role string) {
+	if status := handlers.CheckAccessToken(r, config.GetWsServerToken()); status != http.StatusOK {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		mylog.Printf("Error upgrading ws connection from %s: %v", r.RemoteAddr, err)
+		return
+	}
+
+	client := &WebSocketServerClient{conn: conn, role: role, closeCh: make(chan struct{})}
+	mylog.Printf("正向ws应用端已连接: %s %s", r.RemoteAddr, role)
+	defer func() {
+		clientsMu.Lock()
+		delete(clients, client)
+		clientsMu.Unlock()
+		client.Close()
+		mylog.Printf("正向ws应用端已断开: %s %s", r.RemoteAddr, role)
+	}()
+
+	if role != roleAPI {
+		botID := uint64(config.GetUinint64())
+		client.SendMessage(map[string]interface{}{
+			"meta_event_type": "lifecycle",
+			"post_type":       "meta_event",
+			"self_id":         botID,
+			"sub_type":        "connect",
+			"time":            int(time.Now().Unix()),
+		})
+		clientsMu.Lock()
+		clients[client] = struct{}{}
+		clientsMu.Unlock()
+		go client.sendHeartbeat(botID)
+	}
+
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		// /event 连接不处理api调用
+		if role == roleEvent {
+			continue
+		}
+		go client.handleAction(msg)
+	}
+}
+
+// handleAction 按action分发给注册的handler,响应发回本连接
+func (c *WebSocketServerClient) handleAction(msg []byte) {
+	var message callapi.ActionMessage
+	if err := json.Unmarshal(msg, &message); err != nil {
+		mylog.Printf("Error unmarshalling message: %v, Original message: %s", err, string(msg))
+		return
+	}
+	mylog.Println("Received from forward ws client:", wsclient.TruncateMessage(message, 800))
+	callapi.CallAPIFromDict(c, message)
+}
+
+// sendHeartbeat 按配置的间隔发送心跳,连接关闭后退出
+func (c *WebSocketServerClient) sendHeartbeat(botID uint64) {
+	for {
+		interval := config.GetHeartBeatInterval()
+		if interval <= 0 {
+			interval = 5
+		}
+		select {
+		case <-c.closeCh:
+			return
+		case <-time.After(time.Duration(interval) * time.Second):
+			if err := c.SendMessage(wsclient.HeartbeatMessage(botID, interval)); err != nil {
+				return
+			}
+		}
+	}
+}
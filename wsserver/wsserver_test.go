@@ -0,0 +1,91 @@
+package wsserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/hoshinonyaruko/gensokyo-mcp/config"
+	"github.com/hoshinonyaruko/gensokyo-mcp/template"
+)
+
+// loadTestConfig 以默认配置加载,token 与允许的来源替换为给定值
+func loadTestConfig(t *testing.T, token, allowedOrigins string) {
+	t.Helper()
+	conf := strings.Replace(template.ConfigTemplate, `ws_server_token : ""`, `ws_server_token : "`+token+`"`, 1)
+	conf = strings.Replace(conf, `ws_server_allowed_origins : []`, `ws_server_allowed_origins : `+allowedOrigins, 1)
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(conf), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.LoadConfig(path, false); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// dial 连接 /api,返回握手的http状态码
+func dial(t *testing.T, server *httptest.Server, header http.Header) int {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api"
+	conn, resp, err := websocket.DefaultDialer.Dial(url, header)
+	if conn != nil {
+		conn.Close()
+	}
+	if resp == nil {
+		t.Fatalf("dial: %v", err)
+	}
+	return resp.StatusCode
+}
+
+// TestServeAuth 未设置token时拒绝其他网页的连接,设置token后按token校验
+func TestServeAuth(t *testing.T) {
+	server := httptest.NewServer(Handler())
+	defer server.Close()
+
+	header := func(pairs ...string) http.Header {
+		h := http.Header{}
+		for i := 0; i+1 < len(pairs); i += 2 {
+			h.Set(pairs[i], pairs[i+1])
+		}
+		return h
+	}
+
+	loadTestConfig(t, "", `["http://allowed.example"]`)
+	noToken := []struct {
+		name   string
+		header http.Header
+		want   int
+	}{
+		{"app without origin", header(), http.StatusSwitchingProtocols},
+		{"same origin page", header("Origin", server.URL), http.StatusSwitchingProtocols},
+		{"allowed origin", header("Origin", "http://allowed.example"), http.StatusSwitchingProtocols},
+		{"foreign origin", header("Origin", "http://evil.example"), http.StatusForbidden},
+		{"null origin", header("Origin", "null"), http.StatusForbidden},
+	}
+	for _, tt := range noToken {
+		if got := dial(t, server, tt.header); got != tt.want {
+			t.Errorf("no token, %s: status %d, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	loadTestConfig(t, "secret", `[]`)
+	withToken := []struct {
+		name   string
+		header http.Header
+		want   int
+	}{
+		{"missing token", header(), http.StatusUnauthorized},
+		{"wrong token", header("Authorization", "Bearer nope"), http.StatusForbidden},
+		{"token", header("Authorization", "Bearer secret"), http.StatusSwitchingProtocols},
+		{"token from foreign origin", header("Authorization", "Token secret", "Origin", "http://evil.example"), http.StatusSwitchingProtocols},
+	}
+	for _, tt := range withToken {
+		if got := dial(t, server, tt.header); got != tt.want {
+			t.Errorf("with token, %s: status %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}